@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/auth"
+	"github.com/general252/grpc_invoke/pkg/bench"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/scenario"
+	"github.com/general252/grpc_invoke/pkg/schema"
+	"github.com/general252/grpc_invoke/pkg/stub"
+)
+
+// headerFlags 可重复的 -H key:value
+type headerFlags map[string]string
+
+func (tis headerFlags) String() string {
+	return fmt.Sprint(map[string]string(tis))
+}
+
+func (tis headerFlags) Set(v string) error {
+	k, val, ok := strings.Cut(v, ":")
+	if !ok {
+		return fmt.Errorf("invalid header [%v], want key:value", v)
+	}
+
+	tis[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	return nil
+}
+
+// connectTarget 连接 host:port 或完整的gRPC target, 如 unix:///tmp/grpc.sock, dns:///svc:50051
+func connectTarget(target string) (*stub.Stub, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+
+	cli := stub.NewTargetStub(target)
+	if err := cli.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	return cli, nil
+}
+
+// runBench grpc_invoke bench -target 127.0.0.1:50051 -method helloworld.Greeter/SayHello -c 10 -d 10s
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var target = fs.String("target", "", "gRPC server host:port or target, e.g. dns:///svc:50051")
+	var method = fs.String("method", "", "package.Service/Method")
+	var data = fs.String("data", "{}", "request json")
+	var concurrency = fs.Int("c", 1, "concurrency")
+	var rps = fs.Int("rps", 0, "requests per second, 0 unlimited")
+	var duration = fs.Duration("d", time.Second*10, "duration")
+	var total = fs.Int("n", 0, "total requests, 0 unlimited")
+	var header = headerFlags{}
+	fs.Var(header, "H", "metadata key:value, repeatable")
+	_ = fs.Parse(args)
+
+	i := strings.LastIndex(*method, "/")
+	if i <= 0 {
+		log.Printf("invalid method [%v], want package.Service/Method", *method)
+		return 2
+	}
+	serviceName, methodName := (*method)[:i], (*method)[i+1:]
+
+	opts := bench.Options{
+		Concurrency: *concurrency,
+		RPS:         *rps,
+		DurationMs:  int(duration.Milliseconds()),
+		Total:       *total,
+	}
+	if err := opts.Validate(); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	cli, err := connectTarget(*target)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	report := bench.Run(context.Background(), opts, func(ctx context.Context) error {
+		_, _, _, err := cli.InvokeRPC(ctx, serviceName, methodName, *data, header)
+		return err
+	}, time.Second, func(report *bench.Report) {
+		if !report.Done {
+			log.Printf("requests: %v, rps: %.1f, p99: %.2fms", report.Total, report.RPS, report.Latency.P99)
+		}
+	})
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if report.Success != report.Total {
+		return 1
+	}
+	return 0
+}
+
+// runScenario grpc_invoke scenario -target 127.0.0.1:50051 [-junit report.xml] crud.yaml...
+func runScenario(args []string) int {
+	fs := flag.NewFlagSet("scenario", flag.ExitOnError)
+	var target = fs.String("target", "", "gRPC server host:port or target, overrides target in file")
+	var junit = fs.String("junit", "", "write JUnit report to file")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Println("no scenario file")
+		return 2
+	}
+
+	clients := map[string]*stub.Stub{}
+	var reports []*scenario.Report
+	passed := true
+
+	for _, filename := range fs.Args() {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+
+		s, err := scenario.Parse(data)
+		if err != nil {
+			log.Printf("%v: %v", filename, err)
+			return 1
+		}
+		if len(s.Name) == 0 {
+			s.Name = filename
+		}
+		if len(*target) > 0 {
+			s.Target = *target
+		}
+
+		cli, ok := clients[s.Target]
+		if !ok {
+			if cli, err = connectTarget(s.Target); err != nil {
+				log.Printf("%v: %v", filename, err)
+				return 1
+			}
+			clients[s.Target] = cli
+		}
+
+		report := scenario.Run(context.Background(), s, cli.InvokeRPC, stubSchemas(cli))
+		reports = append(reports, report)
+		printReport(report)
+
+		if !report.Passed {
+			passed = false
+		}
+	}
+
+	if err := writeJUnit(*junit, reports...); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	if !passed {
+		return 1
+	}
+	return 0
+}
+
+// runTest grpc_invoke test -target 127.0.0.1:50051 [-junit report.xml] [-name n] [-workspace dir] [requests.json]
+// 执行保存的请求及断言, 用于CI
+func runTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	var target = fs.String("target", "", "gRPC server host:port or target, e.g. dns:///svc:50051")
+	var junit = fs.String("junit", "", "write JUnit report to file")
+	var names = stringFlags{}
+	fs.Var(&names, "name", "only run the named request, repeatable")
+	var workspace = fs.String("workspace", "", "workspace directory, default $"+config.EnvWorkspace+" or the user config directory")
+	_ = fs.Parse(args)
+
+	if len(*workspace) > 0 {
+		if err := config.SetWorkspaceRoot(*workspace); err != nil {
+			log.Println(err)
+			return 1
+		}
+	}
+
+	filename := fs.Arg(0)
+	if len(filename) == 0 {
+		filename = config.WorkspacePath("requests.json")
+	}
+
+	collection, err := scenario.LoadCollection(filename)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	cli, err := connectTarget(*target)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	report := scenario.Run(context.Background(), collection.Scenario(names...), cli.InvokeRPC, stubSchemas(cli))
+	printReport(report)
+
+	if err = writeJUnit(*junit, report); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// stringFlags 可重复的字符串参数
+type stringFlags []string
+
+func (tis *stringFlags) String() string {
+	return strings.Join(*tis, ",")
+}
+
+func (tis *stringFlags) Set(v string) error {
+	*tis = append(*tis, v)
+	return nil
+}
+
+func stubSchemas(cli *stub.Stub) scenario.SchemaFunc {
+	return func(service, method string) (*schema.JsonSchema, bool) {
+		if objectMethod, ok := cli.GetServerInfo().GetMethod(service, method); ok {
+			return objectMethod.GetResponseJsonSchema(), true
+		}
+		return nil, false
+	}
+}
+
+func printReport(report *scenario.Report) {
+	for _, step := range report.Steps {
+		result := "PASS"
+		if step.Skipped {
+			result = "SKIP"
+		} else if !step.Passed() {
+			result = "FAIL"
+		}
+		fmt.Printf("%v\t%v/%v\t%v\t%.2fms\n", result, report.Name, step.Name, step.Status, step.DurationMs)
+		for _, failure := range step.Failures {
+			fmt.Printf("\t%v\n", failure)
+		}
+	}
+}
+
+func writeJUnit(filename string, reports ...*scenario.Report) error {
+	if len(filename) == 0 {
+		return nil
+	}
+
+	data, err := scenario.JUnit(reports...)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, data, 0644)
+}
+
+// runPasswd 输出配置auth.users使用的bcrypt hash, 未指定密码时从标准输入读取
+func runPasswd(args []string) int {
+	password := strings.Join(args, " ")
+	if len(password) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+	if len(password) == 0 {
+		log.Println("usage: grpc_invoke passwd <password>")
+		return 1
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	fmt.Println(hash)
+	return 0
+}
+
+// runCommand 子命令, 不是子命令时返回false
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+
+	switch os.Args[1] {
+	case "bench":
+		os.Exit(runBench(os.Args[2:]))
+	case "scenario":
+		os.Exit(runScenario(os.Args[2:]))
+	case "test":
+		os.Exit(runTest(os.Args[2:]))
+	case "passwd":
+		os.Exit(runPasswd(os.Args[2:]))
+	}
+
+	return false
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"flag"
-	"fmt"
 	"github.com/general252/grpc_invoke/pkg/browsers"
 	"io"
 	"log"
@@ -17,6 +16,7 @@ import (
 
 	"github.com/general252/grpc_invoke/examples"
 	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/mock"
 	"github.com/general252/grpc_invoke/pkg/server"
 )
 
@@ -25,17 +25,43 @@ func init() {
 }
 
 func main() {
-	var port = flag.Int("port", 8888, "listen port")
+	if runCommand() {
+		return
+	}
+
+	var settingFlags = newSettingFlags()
+	var mockProtoset = flag.String("mock", "", "protoset file, start a mock gRPC server from it")
+	var mockPort = flag.Int("mock-port", 0, "mock gRPC server listen port on 127.0.0.1")
+	var workspace = flag.String("workspace", "", "workspace directory for config.json, swagger and saved data, default $"+config.EnvWorkspace+" or the user config directory")
 	flag.Parse()
 
+	if len(*workspace) > 0 {
+		if err := config.SetWorkspaceRoot(*workspace); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("工作区: %v", config.WorkspaceDir())
+
+	settings, err := settingFlags.resolve()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = server.SetLogLevel(settings.LogLevel); err != nil {
+		log.Fatal(err)
+	}
+
 	serv := server.NewHttpServer()
-	go serv.Server(*port)
+	if err = serv.Listen(settings.Listen); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("监听地址: %v", serv.Addr())
+	go serv.Serve()
 	defer serv.Close()
 
-	if address := traefilServices(); address != nil {
+	if address := traefilServices(settings.Traefik); address != nil {
 		for _, addr := range address {
 			//serv.AddService(addr.Name, addr.Host, addr.Port)
-			_ = serv.AddService(addr.Name, "127.0.0.1", addr.Port)
+			_ = serv.AddService(config.Service{Name: addr.Name, Host: "127.0.0.1", Port: addr.Port})
 		}
 	}
 
@@ -44,17 +70,28 @@ func main() {
 		// serv.AddService("example", "127.0.0.1", port)
 	}
 
-	cfg := config.GetConfig()
-	for _, service := range cfg.Services {
-		_ = serv.AddService(service.Name, service.Host, service.Port)
-	}
-
-	go func() {
-		uri := fmt.Sprintf("http://127.0.0.1:%v", *port)
-		if err := browsers.Open(uri); err != nil {
+	if len(*mockProtoset) > 0 {
+		if files, err := mock.LoadProtoset(*mockProtoset); err != nil {
+			log.Println(err)
+		} else if srv, err := serv.AddMock("mock", files, *mockPort, nil); err != nil {
 			log.Println(err)
+		} else {
+			log.Printf("模拟gRPC服务端口: %v", srv.Port())
 		}
-	}()
+	}
+
+	serv.LoadConfig()
+	for _, service := range settings.Services {
+		_ = serv.AddService(service)
+	}
+
+	if uri := browserURL(serv.Addr()); settings.OpenBrowser && len(uri) > 0 {
+		go func() {
+			if err := browsers.Open(uri); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
 
 	quitChan := make(chan os.Signal, 2)
 	signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -62,8 +99,12 @@ func main() {
 	<-quitChan
 }
 
-func traefilServices() []config.Service {
-	resp, err := http.Get("http://127.0.0.1:58181/api/http/services?search=&status=&per_page=120&page=1")
+func traefilServices(traefik string) []config.Service {
+	if len(traefik) == 0 {
+		return nil
+	}
+
+	resp, err := http.Get(strings.TrimSuffix(traefik, "/") + "/api/http/services?search=&status=&per_page=120&page=1")
 	if err != nil {
 		log.Println(err)
 		return nil
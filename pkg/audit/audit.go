@@ -0,0 +1,309 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/redact"
+)
+
+const (
+	ActionInvoke        = "invoke"         // grpc或http调用
+	ActionBench         = "bench"          // 压测
+	ActionServiceAdd    = "service.add"    // 添加服务
+	ActionServiceRemove = "service.remove" // 删除服务
+	ActionLogin         = "login"          // 登录
+	ActionApi           = "api"            // 其他修改配置的接口
+)
+
+// UserConfig 配置文件变化引起的修改
+const UserConfig = "config"
+
+const (
+	defaultMaxSize    = 10
+	defaultMaxBackups = 5
+)
+
+// Event 一条审计记录
+type Event struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"` // 未启用认证时为空
+	Role   string    `json:"role,omitempty"`
+	Remote string    `json:"remote,omitempty"`
+	Action string    `json:"action"`
+
+	Target  string              `json:"target,omitempty"`
+	Service string              `json:"service,omitempty"`
+	Method  string              `json:"method,omitempty"`
+	Header  map[string][]string `json:"header,omitempty"`
+	Request json.RawMessage     `json:"request,omitempty"`
+
+	Code       int     `json:"code"` // grpc code 或 http status
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+}
+
+type Query struct {
+	User    string    `form:"user"`
+	Action  string    `form:"action"`
+	Service string    `form:"service"`
+	Method  string    `form:"method"`
+	Since   time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until   time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit   int       `form:"limit"`
+}
+
+func (tis *Query) match(e *Event) bool {
+	if len(tis.User) > 0 && e.User != tis.User {
+		return false
+	}
+	if len(tis.Action) > 0 && e.Action != tis.Action {
+		return false
+	}
+	if len(tis.Service) > 0 && e.Service != tis.Service {
+		return false
+	}
+	if len(tis.Method) > 0 && e.Method != tis.Method {
+		return false
+	}
+	if !tis.Since.IsZero() && e.Time.Before(tis.Since) {
+		return false
+	}
+	if !tis.Until.IsZero() && !e.Time.Before(tis.Until) {
+		return false
+	}
+
+	return true
+}
+
+// Logger 只追加的审计日志(json lines), 超过maxSize时轮转为 filename.1 ... filename.N
+type Logger struct {
+	filename   string
+	disabled   bool
+	maxSize    int64
+	maxBackups int
+	redactor   *redact.Redactor
+
+	file *os.File
+	size int64
+	mux  sync.Mutex
+}
+
+func NewLogger(filename string) *Logger {
+	tis := &Logger{filename: filename}
+	tis.Update(nil, redact.New(nil, nil))
+
+	return tis
+}
+
+// Update 使用新的配置, cfg为空时使用默认值
+func (tis *Logger) Update(cfg *config.Audit, redactor *redact.Redactor) {
+	if cfg == nil {
+		cfg = &config.Audit{}
+	}
+
+	maxSize := cfg.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultMaxSize
+	}
+	maxBackups := cfg.MaxBackups
+	if maxBackups == 0 {
+		maxBackups = defaultMaxBackups
+	}
+
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.disabled = cfg.Disabled
+	tis.maxSize = int64(maxSize) * 1024 * 1024
+	tis.maxBackups = maxBackups
+	tis.redactor = redactor
+}
+
+// Add 隐藏敏感内容后追加写入, 不修改e
+func (tis *Logger) Add(e *Event) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	if tis.disabled {
+		return
+	}
+
+	record := *e
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Header = tis.redactor.Header(e.Header)
+	record.Request = tis.redactor.Request(e.Service, e.Method, e.Request)
+
+	data, err := json.Marshal(&record)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	data = append(data, '\n')
+
+	if err = tis.open(); err != nil {
+		log.Println(err)
+		return
+	}
+	if tis.size > 0 && tis.size+int64(len(data)) > tis.maxSize {
+		if err = tis.rotate(); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	n, err := tis.file.Write(data)
+	tis.size += int64(n)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (tis *Logger) open() error {
+	if tis.file != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(tis.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	tis.file = f
+	tis.size = info.Size()
+	return nil
+}
+
+// rotate filename.N-1 -> filename.N, ..., filename -> filename.1
+func (tis *Logger) rotate() error {
+	_ = tis.file.Close()
+	tis.file = nil
+
+	_ = os.Remove(tis.backup(tis.maxBackups))
+	for i := tis.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(tis.backup(i), tis.backup(i+1))
+	}
+	if err := os.Rename(tis.filename, tis.backup(1)); err != nil {
+		return err
+	}
+
+	return tis.open()
+}
+
+func (tis *Logger) backup(n int) string {
+	return fmt.Sprintf("%v.%v", tis.filename, n)
+}
+
+// Find 按条件查找, 包括轮转的文件, 按时间先后排序, Limit大于0时返回最近的Limit条
+// 只在打开文件时加锁, 已打开的文件在轮转时被改名或删除也能继续读取, 当前文件只读取打开时的长度
+func (tis *Logger) Find(q Query) ([]*Event, error) {
+	files, size, err := tis.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+
+	var result []*Event
+	for i, f := range files {
+		var r io.Reader = f
+		if i == len(files)-1 && size >= 0 {
+			r = io.LimitReader(f, size)
+		}
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var e Event
+			if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				continue
+			}
+			if q.match(&e) {
+				result = append(result, &e)
+			}
+		}
+	}
+
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+
+	return result, nil
+}
+
+// openFiles 从最早的轮转文件到当前文件依次打开, size为当前文件已写入的长度, 当前文件不存在时为-1
+func (tis *Logger) openFiles() ([]*os.File, int64, error) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	var files []*os.File
+	for i := tis.maxBackups; i >= 0; i-- {
+		filename := tis.filename
+		if i > 0 {
+			filename = tis.backup(i)
+		}
+
+		f, err := os.Open(filename)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			closeFiles(files)
+			return nil, 0, err
+		}
+		files = append(files, f)
+
+		if i == 0 {
+			info, err := f.Stat()
+			if err != nil {
+				closeFiles(files)
+				return nil, 0, err
+			}
+			return files, info.Size(), nil
+		}
+	}
+
+	return files, -1, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+func (tis *Logger) Close() {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	if tis.file != nil {
+		_ = tis.file.Close()
+		tis.file = nil
+	}
+}
+
+type remoteKey struct{}
+
+// WithRemote 保存请求的客户端地址
+func WithRemote(ctx context.Context, remote string) context.Context {
+	return context.WithValue(ctx, remoteKey{}, remote)
+}
+
+func RemoteFromContext(ctx context.Context) string {
+	remote, _ := ctx.Value(remoteKey{}).(string)
+	return remote
+}
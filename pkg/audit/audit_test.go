@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/redact"
+)
+
+func TestLogger(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l := NewLogger(filename)
+	defer l.Close()
+	l.Update(&config.Audit{MaxBackups: 2}, redact.New([]string{"x-session"}, []string{"card_*"}))
+	l.maxSize = 1024
+
+	for i := 0; i < 40; i++ {
+		l.Add(&Event{
+			User:    "alice",
+			Action:  ActionInvoke,
+			Service: "helloworld.Greeter",
+			Method:  "SayHello",
+			Header: map[string][]string{
+				"authorization": {"Bearer abc"},
+				"x-session":     {"s1"},
+				"x-request-id":  {"r1"},
+			},
+			Request: json.RawMessage(`{"name":"x","password":"p","card_no":"4111","nested":[{"access_token":"t"}]}`),
+		})
+	}
+	l.Add(&Event{User: UserConfig, Action: ActionServiceAdd, Target: "127.0.0.1:50051"})
+
+	// 不修改调用方的event
+	header := map[string][]string{"authorization": {"Bearer abc"}}
+	request := json.RawMessage(`{"password":"p"}`)
+	l.Add(&Event{Action: ActionApi, Header: header, Request: request})
+	if header["authorization"][0] != "Bearer abc" || string(request) != `{"password":"p"}` {
+		t.Errorf("caller event modified: %v %s", header, request)
+	}
+
+	for _, name := range []string{filename, filename + ".1", filename + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1024 {
+			t.Errorf("%v: size %v exceeds max size", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backup beyond max_backups kept: %v", err)
+	}
+
+	events, err := l.Find(Query{Action: ActionInvoke, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %v events, want 1", len(events))
+	}
+
+	e := events[0]
+	if e.Header["authorization"][0] != "***" || e.Header["x-session"][0] != "***" || e.Header["x-request-id"][0] != "r1" {
+		t.Errorf("header not redacted: %v", e.Header)
+	}
+	request = e.Request
+	for _, secret := range []string{`"p"`, "4111", `"t"`} {
+		if strings.Contains(string(request), secret) {
+			t.Errorf("request not redacted: %v", request)
+		}
+	}
+	if !strings.Contains(string(request), `"name":"x"`) {
+		t.Errorf("request field removed: %v", request)
+	}
+
+	events, _ = l.Find(Query{User: UserConfig})
+	if len(events) != 1 || events[0].Action != ActionServiceAdd {
+		t.Errorf("find by user: %v", events)
+	}
+}
+
+// TestLoggerFindWhileRotating 查找时同时写入和轮转, 结果按写入顺序且不重复
+func TestLoggerFindWhileRotating(t *testing.T) {
+	l := NewLogger(filepath.Join(t.TempDir(), "audit.jsonl"))
+	defer l.Close()
+	l.Update(&config.Audit{MaxBackups: 3}, redact.New(nil, nil))
+	l.maxSize = 2048
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			l.Add(&Event{Action: ActionApi, Target: strconv.Itoa(i)})
+		}
+	}()
+
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+
+		events, err := l.Find(Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := -1
+		for _, e := range events {
+			n, _ := strconv.Atoi(e.Target)
+			if n <= last {
+				t.Fatalf("event %v after %v", n, last)
+			}
+			last = n
+		}
+	}
+}
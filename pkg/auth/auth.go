@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionCookie 登录后保存session的cookie
+const SessionCookie = "grpc_invoke_session"
+
+// SessionTTL session有效期
+const SessionTTL = time.Hour * 12
+
+// basicCacheTTL Basic认证校验成功后缓存, 避免每个请求都计算bcrypt
+const basicCacheTTL = time.Minute * 5
+
+var roleRank = map[string]int{
+	config.RoleViewer:  1,
+	config.RoleInvoker: 2,
+	config.RoleAdmin:   3,
+}
+
+// Allows role是否具有required的权限
+func Allows(role, required string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[required]
+}
+
+// Identity 登录的用户或token
+type Identity struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext 未启用认证时没有Identity
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+type permission struct {
+	service *regexp.Regexp
+	methods []*regexp.Regexp
+}
+
+// Authenticator 配置更新时保留已登录的session
+type Authenticator struct {
+	users       map[string]config.User
+	tokens      []config.Token
+	permissions map[string][]permission // role ->
+
+	sessions map[string]*session
+	verified map[string]time.Time // sha256(user:password) -> 过期时间
+	mux      sync.RWMutex
+}
+
+func New() *Authenticator {
+	return &Authenticator{
+		users:       map[string]config.User{},
+		permissions: map[string][]permission{},
+		sessions:    map[string]*session{},
+		verified:    map[string]time.Time{},
+	}
+}
+
+// Update 使用新的配置, cfg为空时关闭认证
+func (tis *Authenticator) Update(cfg *config.Auth) {
+	users := map[string]config.User{}
+	var tokens []config.Token
+	permissions := map[string][]permission{}
+
+	if cfg != nil {
+		for _, user := range cfg.Users {
+			users[user.Name] = user
+		}
+		tokens = cfg.Tokens
+
+		for _, p := range cfg.Permissions {
+			item := permission{service: Glob(p.Service)}
+			for _, method := range p.Methods {
+				item.methods = append(item.methods, Glob(method))
+			}
+			permissions[p.Role] = append(permissions[p.Role], item)
+		}
+	}
+
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.users = users
+	tis.tokens = tokens
+	tis.permissions = permissions
+	tis.verified = map[string]time.Time{}
+}
+
+// Enabled 配置了用户或token时需要认证
+func (tis *Authenticator) Enabled() bool {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	return len(tis.users) > 0 || len(tis.tokens) > 0
+}
+
+// Authenticate 依次检查 Bearer token, Basic, session cookie
+func (tis *Authenticator) Authenticate(r *http.Request) (*Identity, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return tis.token(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		return tis.password(username, password)
+	}
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		return tis.session(cookie.Value)
+	}
+
+	return nil, false
+}
+
+func (tis *Authenticator) token(value string) (*Identity, bool) {
+	tis.mux.RLock()
+	for _, token := range tis.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(value)) == 1 {
+			tis.mux.RUnlock()
+			return &Identity{Name: token.Name, Role: token.Role}, true
+		}
+	}
+	tis.mux.RUnlock()
+
+	// 登录得到的session也可以作为token使用
+	return tis.session(value)
+}
+
+func (tis *Authenticator) session(value string) (*Identity, bool) {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	if s, ok := tis.sessions[value]; ok && time.Now().Before(s.expires) {
+		if user, ok := tis.users[s.user]; ok {
+			return &Identity{Name: user.Name, Role: user.Role}, true
+		}
+	}
+
+	return nil, false
+}
+
+func (tis *Authenticator) password(username, password string) (*Identity, bool) {
+	sum := sha256.Sum256([]byte(username + ":" + password))
+	key := hex.EncodeToString(sum[:])
+
+	tis.mux.RLock()
+	user, ok := tis.users[username]
+	expires, cached := tis.verified[key]
+	tis.mux.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	if cached && time.Now().Before(expires) {
+		return &Identity{Name: user.Name, Role: user.Role}, true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, false
+	}
+
+	tis.mux.Lock()
+	tis.verified[key] = time.Now().Add(basicCacheTTL)
+	tis.mux.Unlock()
+
+	return &Identity{Name: user.Name, Role: user.Role}, true
+}
+
+// Login 校验密码, 返回session
+func (tis *Authenticator) Login(username, password string) (string, *Identity, error) {
+	id, ok := tis.password(username, password)
+	if !ok {
+		return "", nil, fmt.Errorf("invalid username or password")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	value := hex.EncodeToString(buf)
+
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	now := time.Now()
+	for k, s := range tis.sessions {
+		if now.After(s.expires) {
+			delete(tis.sessions, k)
+		}
+	}
+	tis.sessions[value] = &session{user: username, expires: now.Add(SessionTTL)}
+
+	return value, id, nil
+}
+
+func (tis *Authenticator) Logout(value string) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	delete(tis.sessions, value)
+}
+
+// CanInvoke 角色配置了permissions时只能调用匹配的方法, admin不受限制
+func (tis *Authenticator) CanInvoke(id *Identity, service, method string) bool {
+	if !Allows(id.Role, config.RoleInvoker) {
+		return false
+	}
+	if id.Role == config.RoleAdmin {
+		return true
+	}
+
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	permissions, ok := tis.permissions[id.Role]
+	if !ok {
+		return true
+	}
+
+	for _, p := range permissions {
+		if !p.service.MatchString(service) {
+			continue
+		}
+		if len(p.methods) == 0 {
+			return true
+		}
+		for _, m := range p.methods {
+			if m.MatchString(method) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Authorize ctx中的用户是否可以调用, 未启用认证时允许
+func (tis *Authenticator) Authorize(ctx context.Context, service, method string) error {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if !tis.CanInvoke(id, service, method) {
+		return fmt.Errorf("%v (%v) is not allowed to call %v/%v", id.Name, id.Role, service, method)
+	}
+
+	return nil
+}
+
+// Glob 通配符*匹配任意字符
+func Glob(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// HashPassword 生成配置中使用的bcrypt hash
+func HashPassword(password string) (string, error) {
+	data, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(data), err
+}
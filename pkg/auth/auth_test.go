@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+)
+
+func TestAuthenticator(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := New()
+	if a.Enabled() {
+		t.Fatal("enabled without config")
+	}
+
+	a.Update(&config.Auth{
+		Users: []config.User{
+			{Name: "alice", PasswordHash: hash, Role: config.RoleInvoker},
+			{Name: "bob", PasswordHash: hash, Role: config.RoleViewer},
+		},
+		Tokens: []config.Token{
+			{Name: "ci", Token: "0123456789abcdef", Role: config.RoleAdmin},
+		},
+		Permissions: []config.Permission{
+			{Role: config.RoleInvoker, Service: "helloworld.*", Methods: []string{"Get*", "List*"}},
+		},
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("alice", "wrong")
+	if _, ok := a.Authenticate(r); ok {
+		t.Fatal("wrong password accepted")
+	}
+
+	r.SetBasicAuth("alice", "secret")
+	alice, ok := a.Authenticate(r)
+	if !ok || alice.Role != config.RoleInvoker {
+		t.Fatalf("basic auth failed: %v", alice)
+	}
+
+	r.Header.Set("Authorization", "Bearer 0123456789abcdef")
+	if id, ok := a.Authenticate(r); !ok || id.Role != config.RoleAdmin {
+		t.Fatalf("token auth failed: %v", id)
+	}
+
+	token, _, err := a.Login("bob", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	bob, ok := a.Authenticate(r)
+	if !ok || bob.Name != "bob" {
+		t.Fatalf("session auth failed: %v", bob)
+	}
+
+	tests := []struct {
+		id      *Identity
+		service string
+		method  string
+		want    bool
+	}{
+		{alice, "helloworld.Greeter", "GetUser", true},
+		{alice, "helloworld.Greeter", "DeleteUser", false},
+		{alice, "other.Service", "GetUser", false},
+		{bob, "helloworld.Greeter", "GetUser", false},
+		{&Identity{Name: "ci", Role: config.RoleAdmin}, "other.Service", "DeleteUser", true},
+	}
+	for _, tt := range tests {
+		err := a.Authorize(WithIdentity(context.Background(), tt.id), tt.service, tt.method)
+		if (err == nil) != tt.want {
+			t.Errorf("%v %v/%v: got %v, want allowed=%v", tt.id.Name, tt.service, tt.method, err, tt.want)
+		}
+	}
+
+	if err := a.Authorize(context.Background(), "other.Service", "DeleteUser"); err != nil {
+		t.Errorf("without identity: %v", err)
+	}
+
+	a.Logout(token)
+	if _, ok := a.Authenticate(r); ok {
+		t.Fatal("session still valid after logout")
+	}
+}
@@ -0,0 +1,316 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// Options 压测参数
+type Options struct {
+	Concurrency int `json:"concurrency"` // 并发数, 默认 1
+	RPS         int `json:"rps"`         // 每秒请求数, 0 不限速
+	DurationMs  int `json:"duration_ms"` // 持续时间, 默认 10s
+	Total       int `json:"total"`       // 总请求数, 0 不限制, 先到者结束
+}
+
+// 压测参数的上限
+const (
+	MaxConcurrency = 1000
+	MaxRPS         = 100000
+	MaxDurationMs  = 10 * 60 * 1000
+	MaxTotal       = 10000000
+)
+
+// Validate 检查参数范围, 0表示使用默认值
+func (tis *Options) Validate() error {
+	switch {
+	case tis.Concurrency < 0 || tis.Concurrency > MaxConcurrency:
+		return fmt.Errorf("concurrency %v out of range 0-%v", tis.Concurrency, MaxConcurrency)
+	case tis.RPS < 0 || tis.RPS > MaxRPS:
+		return fmt.Errorf("rps %v out of range 0-%v", tis.RPS, MaxRPS)
+	case tis.DurationMs < 0 || tis.DurationMs > MaxDurationMs:
+		return fmt.Errorf("duration_ms %v out of range 0-%v", tis.DurationMs, MaxDurationMs)
+	case tis.Total < 0 || tis.Total > MaxTotal:
+		return fmt.Errorf("total %v out of range 0-%v", tis.Total, MaxTotal)
+	}
+
+	return nil
+}
+
+// Invoker 执行一次调用
+type Invoker func(ctx context.Context) error
+
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Report 压测结果, 时间单位毫秒
+type Report struct {
+	Done       bool           `json:"done"`
+	Total      int            `json:"total"`
+	Success    int            `json:"success"`
+	DurationMs float64        `json:"duration_ms"`
+	RPS        float64        `json:"rps"`
+	Latency    Latency        `json:"latency"`
+	Codes      map[string]int `json:"codes"` // grpc code -> 次数
+}
+
+// 延迟按对数分桶统计, 每个桶比上一个大2%, 百分位的相对误差约1%, 内存与请求数无关
+const (
+	histogramBase    = time.Microsecond
+	histogramGrowth  = 1.02
+	histogramBuckets = 1100 // 最大约48分钟, 更大的计入最后一个桶
+)
+
+var histogramLogGrowth = math.Log(histogramGrowth)
+
+func bucketOf(d time.Duration) int {
+	if d <= histogramBase {
+		return 0
+	}
+
+	i := int(math.Log(float64(d)/float64(histogramBase)) / histogramLogGrowth)
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	return i
+}
+
+// bucketValue 桶的中间值
+func bucketValue(i int) time.Duration {
+	return time.Duration(float64(histogramBase) * math.Pow(histogramGrowth, float64(i)+0.5))
+}
+
+type collector struct {
+	start   time.Time
+	buckets []int
+	total   int
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+	codes   map[string]int
+	success int
+	mux     sync.Mutex
+}
+
+func newCollector() *collector {
+	return &collector{
+		start:   time.Now(),
+		buckets: make([]int, histogramBuckets),
+		codes:   map[string]int{},
+	}
+}
+
+func (tis *collector) add(latency time.Duration, err error) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.buckets[bucketOf(latency)]++
+	if tis.total == 0 || latency < tis.min {
+		tis.min = latency
+	}
+	if latency > tis.max {
+		tis.max = latency
+	}
+	tis.total++
+	tis.sum += latency
+
+	tis.codes[status.Code(err).String()]++
+	if err == nil {
+		tis.success++
+	}
+}
+
+func (tis *collector) report(done bool) *Report {
+	tis.mux.Lock()
+	buckets := append([]int(nil), tis.buckets...)
+	sum, min, max := tis.sum, tis.min, tis.max
+	result := &Report{
+		Done:       done,
+		Total:      tis.total,
+		Success:    tis.success,
+		DurationMs: ms(time.Since(tis.start)),
+		Codes:      map[string]int{},
+	}
+	for k, v := range tis.codes {
+		result.Codes[k] = v
+	}
+	tis.mux.Unlock()
+
+	if result.DurationMs > 0 {
+		result.RPS = float64(result.Total) / (result.DurationMs / 1000)
+	}
+
+	if result.Total == 0 {
+		return result
+	}
+
+	var percentile = func(p float64) float64 {
+		rank := int(float64(result.Total)*p + 0.5)
+		if rank < 1 {
+			rank = 1
+		}
+
+		var value time.Duration
+		count := 0
+		for i, n := range buckets {
+			count += n
+			if count >= rank {
+				value = bucketValue(i)
+				break
+			}
+		}
+
+		if value < min {
+			value = min
+		} else if value > max {
+			value = max
+		}
+		return ms(value)
+	}
+
+	result.Latency = Latency{
+		Min:  ms(min),
+		Mean: ms(sum / time.Duration(result.Total)),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		Max:  ms(max),
+	}
+
+	return result
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Run 执行压测, progress不为nil时每隔interval回调一次当前结果
+func Run(ctx context.Context, opts Options, invoke Invoker, interval time.Duration, progress func(*Report)) *Report {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.DurationMs <= 0 {
+		opts.DurationMs = 10 * 1000
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(opts.DurationMs)*time.Millisecond)
+	defer cancel()
+
+	c := newCollector()
+
+	// 限速: 按固定间隔发放令牌
+	var tokens chan struct{}
+	if opts.RPS > 0 {
+		tokens = make(chan struct{}, opts.Concurrency)
+		go func() {
+			interval := time.Second / time.Duration(opts.RPS)
+			if interval <= 0 {
+				interval = time.Nanosecond
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					select {
+					case tokens <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	var issued int
+	var issuedMux sync.Mutex
+	var next = func() bool {
+		if opts.Total <= 0 {
+			return true
+		}
+
+		issuedMux.Lock()
+		defer issuedMux.Unlock()
+
+		if issued >= opts.Total {
+			return false
+		}
+		issued++
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				}
+
+				if !next() {
+					return
+				}
+
+				start := time.Now()
+				err := invoke(ctx)
+				if ctx.Err() != nil && err != nil {
+					// 结束时被取消的调用不计入
+					return
+				}
+				c.add(time.Since(start), err)
+			}
+		}()
+	}
+
+	if progress != nil {
+		finished := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(finished)
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+	loop:
+		for {
+			select {
+			case <-finished:
+				break loop
+			case <-ticker.C:
+				progress(c.report(false))
+			}
+		}
+	} else {
+		wg.Wait()
+	}
+
+	result := c.report(true)
+	if progress != nil {
+		progress(result)
+	}
+
+	return result
+}
@@ -0,0 +1,69 @@
+package bench
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunTotal(t *testing.T) {
+	var n int
+	report := Run(context.Background(), Options{Concurrency: 1, Total: 10}, func(ctx context.Context) error {
+		n++
+		if n%2 == 0 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	}, 0, nil)
+
+	if report.Total != 10 || report.Success != 5 {
+		t.Fatalf("total %v, success %v", report.Total, report.Success)
+	}
+	if report.Codes["OK"] != 5 || report.Codes["Unavailable"] != 5 {
+		t.Fatalf("codes %v", report.Codes)
+	}
+	if !report.Done || report.Latency.Max < report.Latency.Min {
+		t.Fatalf("report %+v", report)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	valid := []Options{{}, {Concurrency: MaxConcurrency, RPS: MaxRPS, DurationMs: MaxDurationMs, Total: MaxTotal}}
+	for _, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+
+	invalid := []Options{{Concurrency: -1}, {Concurrency: MaxConcurrency + 1}, {RPS: 2e9}, {DurationMs: -1}, {Total: MaxTotal + 1}}
+	for _, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v: want error", opts)
+		}
+	}
+}
+
+func TestCollectorPercentile(t *testing.T) {
+	c := newCollector()
+	for i := 1; i <= 1000; i++ {
+		c.add(time.Duration(i)*time.Millisecond, nil)
+	}
+
+	report := c.report(true)
+	if report.Latency.Min != 1 || report.Latency.Max != 1000 || math.Abs(report.Latency.Mean-500.5) > 0.01 {
+		t.Fatalf("latency %+v", report.Latency)
+	}
+	for _, item := range []struct{ got, want float64 }{
+		{report.Latency.P50, 500},
+		{report.Latency.P90, 900},
+		{report.Latency.P99, 990},
+	} {
+		if math.Abs(item.got-item.want)/item.want > 0.02 {
+			t.Errorf("percentile %v, want %v", item.got, item.want)
+		}
+	}
+}
@@ -1,59 +1,148 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
-var (
-	_defaultConfig = newConfig()
-)
-
-func GetConfig() *config {
-	return _defaultConfig
-}
-
 type config struct {
-	Services []Service `json:"services"`
+	Listen      string      `json:"listen,omitempty" yaml:"listen,omitempty" toml:"listen,omitempty"`                   // :8888, [::1]:8888, unix:///tmp/grpc_invoke.sock
+	OpenBrowser *bool       `json:"open_browser,omitempty" yaml:"open_browser,omitempty" toml:"open_browser,omitempty"` // 启动后打开浏览器, 默认true
+	LogLevel    string      `json:"log_level,omitempty" yaml:"log_level,omitempty" toml:"log_level,omitempty"`          // debug, info, error, silent
+	Discovery   *Discovery  `json:"discovery,omitempty" yaml:"discovery,omitempty" toml:"discovery,omitempty"`          // 服务发现, 默认使用本机traefik
+	Services    []Service   `json:"services" yaml:"services" toml:"services"`
+	HttpProxies []HttpProxy `json:"http_proxies" yaml:"http_proxies" toml:"http_proxies"`
+	Auth        *Auth       `json:"auth,omitempty" yaml:"auth,omitempty" toml:"auth,omitempty"`       // 为空时不需要登录, 只使用默认工作区中的配置
+	Audit       *Audit      `json:"audit,omitempty" yaml:"audit,omitempty" toml:"audit,omitempty"`    // 审计日志, 默认启用
+	Redact      *Redact     `json:"redact,omitempty" yaml:"redact,omitempty" toml:"redact,omitempty"` // 日志, 历史, 审计日志中隐藏的内容
 
 	filename string
 }
 
-func newConfig() *config {
-	dir, _ := GetExeDir()
-	filename := fmt.Sprintf("%v/config.json", dir)
-
+// newConfig 读取配置, 文件不存在时创建
+func newConfig(filename string) *config {
 	tis := &config{
-		filename: filename,
-		Services: []Service{},
+		filename:    filename,
+		Services:    []Service{},
+		HttpProxies: []HttpProxy{},
 	}
 
-	tis.Load()
-	tis.Storage()
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		if err = tis.Storage(); err != nil {
+			log.Println(err)
+		}
+	} else if err = tis.Load(); err != nil {
+		log.Println(err)
+	}
 
 	return tis
 }
 
-func (tis *config) Load() {
+func (tis *config) Filename() string {
+	return tis.filename
+}
+
+// Load 重新读取配置文件, 解析失败时保留原配置
+func (tis *config) Load() error {
 	data, err := os.ReadFile(tis.filename)
 	if err != nil {
-		return
+		return err
 	}
 
-	_ = json.Unmarshal(data, tis)
+	cfg := config{
+		Services:    []Service{},
+		HttpProxies: []HttpProxy{},
+	}
+	if err = decode(tis.filename, data, &cfg); err != nil {
+		return err
+	}
+	if err = cfg.validate(); err != nil {
+		return fmt.Errorf("%v: %v", filepath.Base(tis.filename), err)
+	}
+
+	tis.Listen = cfg.Listen
+	tis.OpenBrowser = cfg.OpenBrowser
+	tis.LogLevel = cfg.LogLevel
+	tis.Discovery = cfg.Discovery
+	tis.Services = cfg.Services
+	tis.HttpProxies = cfg.HttpProxies
+	tis.Auth = cfg.Auth
+	tis.Audit = cfg.Audit
+	tis.Redact = cfg.Redact
+	return nil
 }
 
-func (tis *config) Storage() {
-	data, err := json.MarshalIndent(tis, "", "  ")
+// Storage 按文件格式保存, 内容未变化时不写入
+func (tis *config) Storage() error {
+	data, err := encode(tis.filename, tis)
 	if err != nil {
-		return
+		return err
+	}
+
+	if old, err := os.ReadFile(tis.filename); err == nil && bytes.Equal(old, data) {
+		return nil
 	}
 
-	_ = os.WriteFile(tis.filename, data, os.ModePerm)
+	return os.WriteFile(tis.filename, data, 0644)
 }
 
+func (tis *config) validate() error {
+	switch tis.LogLevel {
+	case "", "debug", "info", "error", "silent":
+	default:
+		return fmt.Errorf("log_level: unknown level %q, want debug, info, error or silent", tis.LogLevel)
+	}
+
+	for i, service := range tis.Services {
+		if err := service.Validate(); err != nil {
+			return fmt.Errorf("services[%v]: %v", i, err)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, proxy := range tis.HttpProxies {
+		if len(proxy.Name) == 0 {
+			return fmt.Errorf("http_proxies[%v]: name is empty", i)
+		}
+		if names[proxy.Name] {
+			return fmt.Errorf("http_proxies[%v]: duplicate name %v", i, proxy.Name)
+		}
+		names[proxy.Name] = true
+
+		if !strings.HasPrefix(proxy.Prefix, "/") {
+			return fmt.Errorf("http_proxies[%v]: prefix %q must start with /", i, proxy.Prefix)
+		}
+		if u, err := url.Parse(proxy.Upstream); err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return fmt.Errorf("http_proxies[%v]: upstream %q must be an absolute url", i, proxy.Upstream)
+		}
+	}
+
+	if tis.Auth != nil {
+		if err := tis.Auth.validate(); err != nil {
+			return fmt.Errorf("auth.%v", err)
+		}
+	}
+
+	if tis.Audit != nil {
+		if tis.Audit.MaxSize < 0 {
+			return fmt.Errorf("audit.max_size: %v is negative", tis.Audit.MaxSize)
+		}
+		if tis.Audit.MaxBackups < 0 {
+			return fmt.Errorf("audit.max_backups: %v is negative", tis.Audit.MaxBackups)
+		}
+	}
+
+	return nil
+}
+
+// GetExeDir 程序所在目录, 保存的数据使用 WorkspaceDir
 func GetExeDir() (string, error) {
 	dir := filepath.Dir(os.Args[0])
 	absDir, err := filepath.Abs(dir)
@@ -61,8 +150,208 @@ func GetExeDir() (string, error) {
 	return absDir, err
 }
 
+// DefaultTraefik 默认查询的traefik api地址
+const DefaultTraefik = "http://127.0.0.1:58181"
+
+// Discovery 服务发现
+type Discovery struct {
+	Traefik string `json:"traefik" yaml:"traefik" toml:"traefik"` // traefik api地址, 为空时不启用
+}
+
 type Service struct {
-	Name string `json:"name"`
-	Host string `json:"host"`
-	Port int    `json:"port"`
+	Name string `json:"name" yaml:"name" toml:"name"`
+	Host string `json:"host" yaml:"host" toml:"host"`
+	Port int    `json:"port" yaml:"port" toml:"port"`
+
+	Target   string `json:"target,omitempty" yaml:"target,omitempty" toml:"target,omitempty"`       // 完整的gRPC target, 如 unix:///tmp/grpc.sock, dns:///svc:50051, passthrough:///127.0.0.1:50051, 设置后不使用host和port
+	Balancer string `json:"balancer,omitempty" yaml:"balancer,omitempty" toml:"balancer,omitempty"` // 负载均衡策略, pick_first, round_robin
+
+	ReadOnly    bool     `json:"read_only,omitempty" yaml:"read_only,omitempty" toml:"read_only,omitempty"`          // 只读模式, 非安全的方法需要确认后调用
+	SafeMethods []string `json:"safe_methods,omitempty" yaml:"safe_methods,omitempty" toml:"safe_methods,omitempty"` // 安全的方法名, 支持通配符*, 默认 Get*, List*, 以及 idempotency_level = NO_SIDE_EFFECTS 的方法
+
+	MaxSendMsgSize int        `json:"max_send_msg_size,omitempty" yaml:"max_send_msg_size,omitempty" toml:"max_send_msg_size,omitempty"` // 发送消息的最大字节数, 默认不限制
+	MaxRecvMsgSize int        `json:"max_recv_msg_size,omitempty" yaml:"max_recv_msg_size,omitempty" toml:"max_recv_msg_size,omitempty"` // 接收消息的最大字节数, 默认4MB
+	Keepalive      *Keepalive `json:"keepalive,omitempty" yaml:"keepalive,omitempty" toml:"keepalive,omitempty"`
+	Compressor     string     `json:"compressor,omitempty" yaml:"compressor,omitempty" toml:"compressor,omitempty"`             // 默认的压缩方式, gzip
+	Authority      string     `json:"authority,omitempty" yaml:"authority,omitempty" toml:"authority,omitempty"`                // 覆盖 :authority
+	UserAgent      string     `json:"user_agent,omitempty" yaml:"user_agent,omitempty" toml:"user_agent,omitempty"`             // 添加在grpc-go的User-Agent之前
+	ServiceConfig  string     `json:"service_config,omitempty" yaml:"service_config,omitempty" toml:"service_config,omitempty"` // 默认的service config json, 服务端未通过解析器提供时使用
+
+	PassAuthorization bool `json:"pass_authorization,omitempty" yaml:"pass_authorization,omitempty" toml:"pass_authorization,omitempty"` // 启用认证时, /gw/ 调用也转发Authorization(本工具的凭证), 默认不转发
+}
+
+// Keepalive 连接空闲时发送ping
+type Keepalive struct {
+	Time                int  `json:"time,omitempty" yaml:"time,omitempty" toml:"time,omitempty"`                                                    // 无数据时发送ping的间隔(秒), 最小10
+	Timeout             int  `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`                                           // 等待ping回复的时间(秒), 默认20
+	PermitWithoutStream bool `json:"permit_without_stream,omitempty" yaml:"permit_without_stream,omitempty" toml:"permit_without_stream,omitempty"` // 没有调用时也发送ping
+}
+
+// Address target, 未设置时为 host:port
+func (tis *Service) Address() string {
+	if len(tis.Target) > 0 {
+		return tis.Target
+	}
+
+	return fmt.Sprintf("%v:%v", tis.Host, tis.Port)
+}
+
+// Validate 检查地址和连接参数
+func (tis *Service) Validate() error {
+	if len(tis.Target) > 0 {
+		if len(tis.Host) > 0 || tis.Port != 0 {
+			return fmt.Errorf("target and host/port are mutually exclusive")
+		}
+		if strings.ContainsAny(tis.Target, " \t\r\n") {
+			return fmt.Errorf("target %q contains whitespace", tis.Target)
+		}
+	} else {
+		if len(tis.Host) == 0 {
+			return fmt.Errorf("host is empty")
+		}
+		if tis.Port <= 0 || tis.Port > 65535 {
+			return fmt.Errorf("port %v out of range 1-65535", tis.Port)
+		}
+	}
+	switch tis.Balancer {
+	case "", "pick_first", "round_robin":
+	default:
+		return fmt.Errorf("unknown balancer %q, want pick_first or round_robin", tis.Balancer)
+	}
+	for _, pattern := range tis.SafeMethods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("safe_methods %q: %v", pattern, err)
+		}
+	}
+	if tis.MaxSendMsgSize < 0 {
+		return fmt.Errorf("max_send_msg_size %v is negative", tis.MaxSendMsgSize)
+	}
+	if tis.MaxRecvMsgSize < 0 {
+		return fmt.Errorf("max_recv_msg_size %v is negative", tis.MaxRecvMsgSize)
+	}
+	if tis.Keepalive != nil && (tis.Keepalive.Time < 0 || tis.Keepalive.Timeout < 0) {
+		return fmt.Errorf("keepalive time and timeout must not be negative")
+	}
+	switch tis.Compressor {
+	case "", "gzip", "identity":
+	default:
+		return fmt.Errorf("unknown compressor %q, want gzip or identity", tis.Compressor)
+	}
+	if len(tis.ServiceConfig) > 0 && !json.Valid([]byte(tis.ServiceConfig)) {
+		return fmt.Errorf("service_config is not valid json")
+	}
+
+	return nil
+}
+
+// HttpProxy /http/{Prefix}/... 转发到Upstream
+type HttpProxy struct {
+	Name         string            `json:"name" yaml:"name" toml:"name"`
+	Prefix       string            `json:"prefix" yaml:"prefix" toml:"prefix"`                                                    // /api
+	Upstream     string            `json:"upstream" yaml:"upstream" toml:"upstream"`                                              // http://127.0.0.1:9780/base
+	StripPrefix  bool              `json:"strip_prefix,omitempty" yaml:"strip_prefix,omitempty" toml:"strip_prefix,omitempty"`    // 转发时去掉Prefix
+	SetHeader    map[string]string `json:"set_header,omitempty" yaml:"set_header,omitempty" toml:"set_header,omitempty"`          // 设置请求头
+	RemoveHeader []string          `json:"remove_header,omitempty" yaml:"remove_header,omitempty" toml:"remove_header,omitempty"` // 删除请求头
+	Auth         *HttpProxyAuth    `json:"auth,omitempty" yaml:"auth,omitempty" toml:"auth,omitempty"`                            // 注入认证
+
+	PassAuthorization bool `json:"pass_authorization,omitempty" yaml:"pass_authorization,omitempty" toml:"pass_authorization,omitempty"` // 转发本工具的session cookie, 启用认证时还有Authorization, 默认删除
+}
+
+// HttpProxyAuth Token不为空时使用Bearer, 否则使用Basic
+type HttpProxyAuth struct {
+	Username string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty" toml:"token,omitempty"`
+}
+
+const (
+	RoleViewer  = "viewer"  // 查看服务和历史
+	RoleInvoker = "invoker" // 调用方法, 压测, 执行场景
+	RoleAdmin   = "admin"   // 添加删除服务, 模拟服务, 代理, 工作区
+)
+
+// Auth 用户使用bcrypt密码登录, 或使用token
+type Auth struct {
+	Users       []User       `json:"users,omitempty" yaml:"users,omitempty" toml:"users,omitempty"`
+	Tokens      []Token      `json:"tokens,omitempty" yaml:"tokens,omitempty" toml:"tokens,omitempty"`
+	Permissions []Permission `json:"permissions,omitempty" yaml:"permissions,omitempty" toml:"permissions,omitempty"` // 角色可调用的方法, 角色没有配置时可调用全部
+}
+
+type User struct {
+	Name         string `json:"name" yaml:"name" toml:"name"`
+	PasswordHash string `json:"password_hash" yaml:"password_hash" toml:"password_hash"` // bcrypt, grpc_invoke passwd 生成
+	Role         string `json:"role" yaml:"role" toml:"role"`
+}
+
+type Token struct {
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Token string `json:"token" yaml:"token" toml:"token"` // Authorization: Bearer <token>
+	Role  string `json:"role" yaml:"role" toml:"role"`
+}
+
+// Permission 角色可调用的服务和方法, 支持通配符*
+type Permission struct {
+	Role    string   `json:"role" yaml:"role" toml:"role"`
+	Service string   `json:"service" yaml:"service" toml:"service"`                               // helloworld.Greeter, helloworld.*
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty" toml:"methods,omitempty"` // Get*, 为空时全部
+}
+
+func validRole(role string) bool {
+	return role == RoleViewer || role == RoleInvoker || role == RoleAdmin
+}
+
+func (tis *Auth) validate() error {
+	names := map[string]bool{}
+	for i, user := range tis.Users {
+		if len(user.Name) == 0 {
+			return fmt.Errorf("users[%v]: name is empty", i)
+		}
+		if names[user.Name] {
+			return fmt.Errorf("users[%v]: duplicate name %v", i, user.Name)
+		}
+		names[user.Name] = true
+
+		if !strings.HasPrefix(user.PasswordHash, "$2") {
+			return fmt.Errorf("users[%v]: password_hash is not a bcrypt hash", i)
+		}
+		if !validRole(user.Role) {
+			return fmt.Errorf("users[%v]: unknown role %q", i, user.Role)
+		}
+	}
+
+	for i, token := range tis.Tokens {
+		if len(token.Token) < 16 {
+			return fmt.Errorf("tokens[%v]: token must be at least 16 characters", i)
+		}
+		if !validRole(token.Role) {
+			return fmt.Errorf("tokens[%v]: unknown role %q", i, token.Role)
+		}
+	}
+
+	for i, permission := range tis.Permissions {
+		if !validRole(permission.Role) {
+			return fmt.Errorf("permissions[%v]: unknown role %q", i, permission.Role)
+		}
+		if len(permission.Service) == 0 {
+			return fmt.Errorf("permissions[%v]: service is empty", i)
+		}
+	}
+
+	return nil
+}
+
+// Audit 审计日志保存在工作区根目录的audit.jsonl, 超过MaxSize后轮转
+type Audit struct {
+	Disabled      bool     `json:"disabled,omitempty" yaml:"disabled,omitempty" toml:"disabled,omitempty"`
+	MaxSize       int      `json:"max_size,omitempty" yaml:"max_size,omitempty" toml:"max_size,omitempty"`                   // MB, 默认10
+	MaxBackups    int      `json:"max_backups,omitempty" yaml:"max_backups,omitempty" toml:"max_backups,omitempty"`          // 保留的轮转文件数, 默认5
+	RedactHeaders []string `json:"redact_headers,omitempty" yaml:"redact_headers,omitempty" toml:"redact_headers,omitempty"` // 只在审计日志中隐藏的header, 在redact.headers之外
+	RedactFields  []string `json:"redact_fields,omitempty" yaml:"redact_fields,omitempty" toml:"redact_fields,omitempty"`    // 只在审计日志中隐藏的字段名, 在redact.fields之外
+}
+
+// Redact 在默认规则之外隐藏的header和字段, 字段选项 debug_redact = true 的字段总是隐藏
+type Redact struct {
+	Headers  []string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`    // 默认 authorization, cookie 等
+	Fields   []string `json:"fields,omitempty" yaml:"fields,omitempty" toml:"fields,omitempty"`       // 支持通配符*, 默认 *password*, *token*, *secret*
+	Response bool     `json:"response,omitempty" yaml:"response,omitempty" toml:"response,omitempty"` // 调用接口返回给页面的回复也隐藏
 }
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"config.json", `{"services": [{"name": "a", "host": "127.0.0.1", "port": 50051}]}`, ""},
+		{"config.json", "{\n  \"services\": [],\n  \"other\": 1\n}", "config.json:3:3: unknown key \"other\""},
+		{"config.json", "{\n  \"services\": 1\n}", "config.json:2:16: cannot use number as []config.Service for services"},
+		{"config.yaml", "services:\n  - name: a\n    host: 127.0.0.1\n    port: 50051\n", ""},
+		{"config.yaml", "services:\n  - name: a\n    hots: 127.0.0.1\n", "config.yaml:3:5: unknown key hots"},
+		{"config.toml", "[[services]]\nname = \"a\"\nhost = \"127.0.0.1\"\nport = 50051\n", ""},
+		{"config.toml", "[[services]]\nname = \"a\"\nport = 0\n", "config.toml: services[0]: host is empty"},
+		{"config.toml", "[[services]]\nnmae = \"a\"\n", "config.toml:2:1: unknown key services.nmae"},
+		{"config.yaml", "services:\n  - name: a\n    host: 127.0.0.1\n    port: 50051\n    compressor: gzip\n    keepalive:\n      time: 30\n", ""},
+		{"config.yaml", "services:\n  - name: a\n    host: 127.0.0.1\n    port: 50051\n    compressor: br\n", "config.yaml: services[0]: unknown compressor \"br\", want gzip or identity"},
+		{"config.json", `{"services": [{"host": "h", "port": 1, "service_config": "{"}]}`, "config.json: services[0]: service_config is not valid json"},
+		{"config.yaml", "services:\n  - name: a\n    target: unix:///tmp/a.sock\n    port: 50051\n", "config.yaml: services[0]: target and host/port are mutually exclusive"},
+		{"config.yaml", "services:\n  - name: a\n    target: dns:///a:50051\n    balancer: random\n", "config.yaml: services[0]: unknown balancer \"random\", want pick_first or round_robin"},
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), test.name)
+		if err := os.WriteFile(filename, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := &config{filename: filename}
+		err := cfg.Load()
+		if len(test.err) == 0 {
+			if err != nil {
+				t.Errorf("%v: %v", test.name, err)
+			} else if len(cfg.Services) != 1 || cfg.Services[0].Port != 50051 {
+				t.Errorf("%v: %+v", test.name, cfg.Services)
+			}
+		} else if err == nil || err.Error() != test.err {
+			t.Errorf("%v: want %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestStorageUnchanged(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+
+	cfg := newConfig(filename)
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(filename, old, old)
+
+	cfg = newConfig(filename)
+	if err = cfg.Storage(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = os.Stat(filename); err != nil || info.ModTime().Unix() != old.Unix() {
+		t.Fatalf("rewritten %v", info.ModTime())
+	}
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configNames 工作区中按顺序查找的配置文件, 都不存在时使用config.json
+var configNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+func findConfig(dir string) string {
+	for _, name := range configNames {
+		filename := filepath.Join(dir, name)
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+
+	return filepath.Join(dir, configNames[0])
+}
+
+func format(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+
+	return "json"
+}
+
+// decode 按文件扩展名解析, 不允许未知的key, 错误包含 文件:行:列
+func decode(filename string, data []byte, v any) error {
+	name := filepath.Base(filename)
+
+	switch format(filename) {
+	case "yaml":
+		return decodeYaml(name, data, v)
+	case "toml":
+		return decodeToml(name, data, v)
+	}
+
+	return decodeJson(name, data, v)
+}
+
+func encode(filename string, v any) ([]byte, error) {
+	switch format(filename) {
+	case "yaml":
+		return yaml.Marshal(v)
+	case "toml":
+		return toml.Marshal(v)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	return append(data, '\n'), err
+}
+
+// position 偏移转为行列, 从1开始
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func decodeJson(name string, data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, column := position(data, syntaxErr.Offset)
+		return fmt.Errorf("%v:%v:%v: %v", name, line, column, syntaxErr.Error())
+	case errors.As(err, &typeErr):
+		line, column := position(data, typeErr.Offset)
+		return fmt.Errorf("%v:%v:%v: cannot use %v as %v for %v", name, line, column, typeErr.Value, typeErr.Type, typeErr.Field)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		key := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		if i := bytes.Index(data, []byte(key)); i >= 0 {
+			line, column := position(data, int64(i))
+			return fmt.Errorf("%v:%v:%v: unknown key %v", name, line, column, key)
+		}
+		return fmt.Errorf("%v: unknown key %v", name, key)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		line, column := position(data, int64(len(data)))
+		return fmt.Errorf("%v:%v:%v: unexpected end of file", name, line, column)
+	}
+
+	return fmt.Errorf("%v: %v", name, err)
+}
+
+func decodeYaml(name string, data []byte, v any) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("%v: %v", name, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+
+	if len(node.Content) == 0 {
+		return nil
+	}
+
+	if err := unknownYamlKeys(name, node.Content[0], reflect.TypeOf(v)); err != nil {
+		return err
+	}
+
+	if err := node.Decode(v); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("%v: %v", name, strings.Join(typeErr.Errors, "; "))
+		}
+		return fmt.Errorf("%v: %v", name, err)
+	}
+
+	return nil
+}
+
+// unknownYamlKeys 按yaml tag检查未知的key
+func unknownYamlKeys(name string, node *yaml.Node, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if key, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); len(key) > 0 && key != "-" {
+				fields[key] = field.Type
+			}
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				return fmt.Errorf("%v:%v:%v: unknown key %v", name, key.Line, key.Column, key.Value)
+			}
+			if err := unknownYamlKeys(name, node.Content[i+1], fieldType); err != nil {
+				return err
+			}
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := unknownYamlKeys(name, item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func decodeToml(name string, data []byte, v any) error {
+	err := toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	var decodeErr *toml.DecodeError
+	var strictErr *toml.StrictMissingError
+	switch {
+	case errors.As(err, &strictErr) && len(strictErr.Errors) > 0:
+		e := strictErr.Errors[0]
+		line, column := e.Position()
+		return fmt.Errorf("%v:%v:%v: unknown key %v", name, line, column, strings.Join(e.Key(), "."))
+	case errors.As(err, &decodeErr):
+		line, column := decodeErr.Position()
+		return fmt.Errorf("%v:%v:%v: %v", name, line, column, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+	}
+
+	return fmt.Errorf("%v: %v", name, err)
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// EnvWorkspace 工作区根目录的环境变量
+const EnvWorkspace = "GRPC_INVOKE_WORKSPACE"
+
+// DefaultWorkspace 默认工作区即根目录, 其他工作区在 <根目录>/workspaces/<名称>
+const DefaultWorkspace = "default"
+
+var workspaceName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+var _workspace = &workspace{name: DefaultWorkspace}
+
+type workspace struct {
+	root    string
+	name    string
+	cfg     *config // 当前工作区的配置, 默认工作区时与rootCfg相同
+	rootCfg *config
+	mux     sync.Mutex
+}
+
+// SetWorkspaceRoot 设置工作区根目录(-workspace), 需在GetConfig之前调用
+func SetWorkspaceRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	_workspace.root = abs
+	_workspace.cfg = nil
+	_workspace.rootCfg = nil
+	return nil
+}
+
+// WorkspaceRoot 工作区根目录, 依次为 -workspace, 环境变量, 程序目录(已有config.json时), $XDG_CONFIG_HOME/grpc_invoke
+func WorkspaceRoot() string {
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	return _workspace.rootDir()
+}
+
+func (tis *workspace) rootDir() string {
+	if len(tis.root) > 0 {
+		return tis.root
+	}
+
+	if dir := os.Getenv(EnvWorkspace); len(dir) > 0 {
+		tis.root, _ = filepath.Abs(dir)
+		return tis.root
+	}
+
+	// 兼容旧版本, 配置保存在程序目录
+	if dir, err := GetExeDir(); err == nil {
+		if _, err = os.Stat(findConfig(dir)); err == nil {
+			tis.root = dir
+			return tis.root
+		}
+	}
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		tis.root = filepath.Join(dir, "grpc_invoke")
+	} else {
+		tis.root, _ = GetExeDir()
+	}
+
+	return tis.root
+}
+
+func (tis *workspace) dir(name string) string {
+	if name == DefaultWorkspace {
+		return tis.rootDir()
+	}
+
+	return filepath.Join(tis.rootDir(), "workspaces", name)
+}
+
+// WorkspaceName 当前工作区名称
+func WorkspaceName() string {
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	return _workspace.name
+}
+
+// WorkspaceDir 当前工作区目录, config.json, swagger目录和保存的数据都在此目录
+func WorkspaceDir() string {
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	return _workspace.dir(_workspace.name)
+}
+
+// WorkspacePath 当前工作区中的文件
+func WorkspacePath(elem ...string) string {
+	return filepath.Join(append([]string{WorkspaceDir()}, elem...)...)
+}
+
+// Workspaces 全部工作区名称
+func Workspaces() []string {
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	names := []string{DefaultWorkspace}
+
+	entries, _ := os.ReadDir(filepath.Join(_workspace.rootDir(), "workspaces"))
+	for _, entry := range entries {
+		if entry.IsDir() && workspaceName.MatchString(entry.Name()) && entry.Name() != DefaultWorkspace {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Strings(names[1:])
+	return names
+}
+
+// SwitchWorkspace 切换工作区, 不存在时创建, 重新加载配置
+func SwitchWorkspace(name string) error {
+	if !workspaceName.MatchString(name) {
+		return fmt.Errorf("invalid workspace name %q", name)
+	}
+
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	if err := os.MkdirAll(_workspace.dir(name), 0755); err != nil {
+		return err
+	}
+
+	_workspace.name = name
+	_workspace.cfg = nil
+	return nil
+}
+
+// GetConfig 当前工作区的配置
+func GetConfig() *config {
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	if _workspace.cfg == nil {
+		if _workspace.name == DefaultWorkspace {
+			_workspace.cfg = _workspace.rootConfig()
+		} else {
+			dir := _workspace.dir(_workspace.name)
+			_ = os.MkdirAll(dir, 0755)
+			_workspace.cfg = newConfig(findConfig(dir))
+		}
+	}
+
+	return _workspace.cfg
+}
+
+// RootConfig 默认工作区(根目录)的配置, auth只使用此配置, 切换工作区不影响登录和权限
+func RootConfig() *config {
+	_workspace.mux.Lock()
+	defer _workspace.mux.Unlock()
+
+	return _workspace.rootConfig()
+}
+
+func (tis *workspace) rootConfig() *config {
+	if tis.rootCfg == nil {
+		dir := tis.rootDir()
+		_ = os.MkdirAll(dir, 0755)
+		tis.rootCfg = newConfig(findConfig(dir))
+	}
+
+	return tis.rootCfg
+}
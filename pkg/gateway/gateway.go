@@ -0,0 +1,512 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MetadataHeaderPrefix http请求头 Grpc-Metadata-Key 转为grpc metadata key
+const MetadataHeaderPrefix = "Grpc-Metadata-"
+
+// Route 由 google.api.http 注解生成的路由
+type Route struct {
+	HttpMethod   string `json:"http_method"`
+	Path         string `json:"path"`
+	Body         string `json:"body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Service      string `json:"service"`
+	Method       string `json:"method"`
+
+	tmpl *pathTemplate
+	mtd  *desc.MethodDescriptor
+	cli  *stub.Stub
+}
+
+// Call 一次REST转换的grpc调用
+type Call struct {
+	Target   string
+	Service  string
+	Method   string
+	Request  []byte
+	Err      error
+	Duration time.Duration
+}
+
+// Gateway 将REST请求按注解转换为grpc调用
+type Gateway struct {
+	// Authorize 不为空时调用前检查, 返回错误时拒绝
+	Authorize func(r *http.Request, cli *stub.Stub, service, method string) error
+	// OnInvoke 不为空时每次调用后通知
+	OnInvoke func(r *http.Request, call *Call)
+	// ForwardAuthorization 不为空且返回false时不转发Authorization请求头, 仍可使用 Grpc-Metadata-Authorization
+	ForwardAuthorization func(r *http.Request, cli *stub.Stub) bool
+
+	routes []*Route
+	mux    sync.RWMutex
+}
+
+func New() *Gateway {
+	return &Gateway{
+		routes: []*Route{},
+	}
+}
+
+// Register 添加服务的全部路由, 同一服务重复注册时替换
+func (tis *Gateway) Register(cli *stub.Stub) {
+	var routes []*Route
+	for _, service := range cli.GetServerInfo().Services {
+		for _, method := range service.Methods {
+			mtd := method.GetMethodDescriptor()
+			for _, rule := range httpRules(mtd) {
+				route, err := newRoute(rule, mtd)
+				if err != nil {
+					continue
+				}
+
+				route.cli = cli
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.unregister(cli)
+	tis.routes = append(tis.routes, routes...)
+}
+
+// Unregister 删除服务的全部路由
+func (tis *Gateway) Unregister(cli *stub.Stub) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.unregister(cli)
+}
+
+func (tis *Gateway) unregister(cli *stub.Stub) {
+	var routes []*Route
+	for _, route := range tis.routes {
+		if route.cli != cli {
+			routes = append(routes, route)
+		}
+	}
+
+	tis.routes = routes
+}
+
+func (tis *Gateway) Routes() []*Route {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	return append([]*Route(nil), tis.routes...)
+}
+
+func (tis *Gateway) find(httpMethod, path string) (*Route, map[string]string, bool) {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	for _, route := range tis.routes {
+		if route.HttpMethod != httpMethod {
+			continue
+		}
+
+		if values, ok := route.tmpl.match(path); ok {
+			return route, values, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// httpRules 读取方法的 google.api.http 注解, 包括 additional_bindings
+func httpRules(mtd *desc.MethodDescriptor) []*annotations.HttpRule {
+	opts := mtd.GetMethodOptions()
+	if opts == nil {
+		return nil
+	}
+
+	// 反射得到的选项中扩展字段可能未解析, 重新解析一次
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	var parsed descriptorpb.MethodOptions
+	if err = (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(data, &parsed); err != nil {
+		return nil
+	}
+
+	rule, ok := proto.GetExtension(&parsed, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+
+	return append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+}
+
+func newRoute(rule *annotations.HttpRule, mtd *desc.MethodDescriptor) (*Route, error) {
+	route := &Route{
+		Body:         rule.GetBody(),
+		ResponseBody: rule.GetResponseBody(),
+		Service:      mtd.GetService().GetFullyQualifiedName(),
+		Method:       mtd.GetName(),
+		mtd:          mtd,
+	}
+
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		route.HttpMethod, route.Path = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		route.HttpMethod, route.Path = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		route.HttpMethod, route.Path = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		route.HttpMethod, route.Path = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		route.HttpMethod, route.Path = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		route.HttpMethod, route.Path = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("no pattern")
+	}
+
+	tmpl, err := parseTemplate(route.Path)
+	if err != nil {
+		return nil, err
+	}
+	route.tmpl = tmpl
+
+	return route, nil
+}
+
+// Handle 处理REST请求, path为去掉前缀后的路径
+func (tis *Gateway) Handle(w http.ResponseWriter, r *http.Request, path string) {
+	route, values, ok := tis.find(r.Method, path)
+	if !ok {
+		writeError(w, status.Errorf(codes.NotFound, "no route for %v %v", r.Method, path))
+		return
+	}
+
+	if tis.Authorize != nil {
+		if err := tis.Authorize(r, route.cli, route.Service, route.Method); err != nil {
+			code := codes.PermissionDenied
+			if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+				code = s.Code()
+			}
+			writeError(w, status.Error(code, err.Error()))
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	request, err := route.buildRequest(values, r.URL.Query(), body)
+	if err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	forward := tis.ForwardAuthorization == nil || tis.ForwardAuthorization(r, route.cli)
+
+	start := time.Now()
+	resp, header, trailer, err := route.cli.InvokeRPC(r.Context(), route.Service, route.Method, string(request), incomingMetadata(r.Header, forward))
+	if tis.OnInvoke != nil {
+		tis.OnInvoke(r, &Call{
+			Target:   route.cli.Target(),
+			Service:  route.Service,
+			Method:   route.Method,
+			Request:  request,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+	writeMetadata(w, header)
+	writeMetadata(w, trailer)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data := []byte(resp)
+	if len(route.ResponseBody) > 0 {
+		var object map[string]any
+		if err = json.Unmarshal(data, &object); err == nil {
+			fd := route.mtd.GetOutputType().FindFieldByName(route.ResponseBody)
+			if fd != nil {
+				data, _ = json.Marshal(object[fd.GetJSONName()])
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// buildRequest 按注解合并路径变量, 查询参数和body为请求json
+func (tis *Route) buildRequest(values map[string]string, query map[string][]string, body []byte) ([]byte, error) {
+	inputType := tis.mtd.GetInputType()
+	request := map[string]any{}
+
+	switch tis.Body {
+	case "":
+	case "*":
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &request); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if len(body) > 0 {
+			var v any
+			if err := json.Unmarshal(body, &v); err != nil {
+				return nil, err
+			}
+			if err := setField(request, inputType, tis.Body, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// body为*时不使用查询参数
+	if tis.Body != "*" {
+		for key, items := range query {
+			if _, ok := values[key]; ok {
+				continue
+			}
+			if len(tis.Body) > 0 && (key == tis.Body || strings.HasPrefix(key, tis.Body+".")) {
+				continue
+			}
+
+			fd, err := findField(inputType, key)
+			if err != nil {
+				// 未知的查询参数忽略
+				continue
+			}
+
+			v, err := convertValues(fd, items)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", key, err)
+			}
+			if err = setField(request, inputType, key, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for key, value := range values {
+		fd, err := findField(inputType, key)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := convertValues(fd, []string{value})
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", key, err)
+		}
+		if err = setField(request, inputType, key, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(request)
+}
+
+// findField 按字段路径(a.b.c)查找, 支持proto名称和json名称
+func findField(md *desc.MessageDescriptor, fieldPath string) (*desc.FieldDescriptor, error) {
+	var fd *desc.FieldDescriptor
+	for i, name := range strings.Split(fieldPath, ".") {
+		if i > 0 {
+			if fd.GetMessageType() == nil || fd.IsRepeated() {
+				return nil, fmt.Errorf("field %v: %v is not a message", fieldPath, fd.GetName())
+			}
+			md = fd.GetMessageType()
+		}
+
+		fd = md.FindFieldByName(name)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("field %v: %v not found in %v", fieldPath, name, md.GetFullyQualifiedName())
+		}
+	}
+
+	return fd, nil
+}
+
+// setField 按字段路径设置值, 使用json名称
+func setField(request map[string]any, md *desc.MessageDescriptor, fieldPath string, v any) error {
+	names := strings.Split(fieldPath, ".")
+	obj := request
+	for i, name := range names {
+		fd, err := findField(md, name)
+		if err != nil {
+			return fmt.Errorf("field %v: %v", fieldPath, err)
+		}
+
+		if i == len(names)-1 {
+			obj[fd.GetJSONName()] = v
+			return nil
+		}
+
+		child, ok := obj[fd.GetJSONName()].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			obj[fd.GetJSONName()] = child
+		}
+
+		obj = child
+		md = fd.GetMessageType()
+	}
+
+	return nil
+}
+
+// convertValues 按字段类型转换字符串, 64位整数, 枚举等保留字符串
+func convertValues(fd *desc.FieldDescriptor, items []string) (any, error) {
+	var convert = func(s string) (any, error) {
+		switch fd.GetType() {
+		case descriptor.FieldDescriptorProto_TYPE_BOOL:
+			return strconv.ParseBool(s)
+		case descriptor.FieldDescriptorProto_TYPE_INT32,
+			descriptor.FieldDescriptorProto_TYPE_SINT32,
+			descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+			return strconv.ParseInt(s, 10, 32)
+		case descriptor.FieldDescriptorProto_TYPE_UINT32,
+			descriptor.FieldDescriptorProto_TYPE_FIXED32:
+			return strconv.ParseUint(s, 10, 32)
+		case descriptor.FieldDescriptorProto_TYPE_FLOAT,
+			descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+			return strconv.ParseFloat(s, 64)
+		case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+			return nil, fmt.Errorf("message field can not be set from string")
+		}
+		return s, nil
+	}
+
+	if !fd.IsRepeated() {
+		if len(items) == 0 {
+			return nil, nil
+		}
+		return convert(items[len(items)-1])
+	}
+
+	var result []any
+	for _, item := range items {
+		v, err := convert(item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+// incomingMetadata Grpc-Metadata-* 转为metadata, authorization为true时转发Authorization
+func incomingMetadata(header http.Header, authorization bool) map[string]string {
+	result := map[string]string{}
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(k, "Authorization") {
+			if authorization {
+				result["authorization"] = v[0]
+			}
+		} else if strings.HasPrefix(k, MetadataHeaderPrefix) {
+			result[strings.ToLower(strings.TrimPrefix(k, MetadataHeaderPrefix))] = v[0]
+		}
+	}
+
+	return result
+}
+
+func writeMetadata(w http.ResponseWriter, md metadata.MD) {
+	for k, values := range md {
+		if k == "content-type" {
+			continue
+		}
+		for _, v := range values {
+			w.Header().Add(MetadataHeaderPrefix+k, v)
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	data, _ := json.Marshal(map[string]any{
+		"code":    int(st.Code()),
+		"message": st.Message(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatusFromCode(st.Code()))
+	_, _ = w.Write(data)
+}
+
+// HTTPStatusFromCode grpc code 对应的http状态码
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.Unknown:
+		return http.StatusInternalServerError
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Internal:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DataLoss:
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusInternalServerError
+}
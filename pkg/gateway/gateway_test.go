@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/mock"
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func testFile(t *testing.T) *desc.FileDescriptor {
+	opts := &descriptorpb.MethodOptions{}
+	proto.SetExtension(opts, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Post{Post: "/v1/{parent=shelves/*}/books"},
+		Body:    "book",
+		AdditionalBindings: []*annotations.HttpRule{
+			{Pattern: &annotations.HttpRule_Get{Get: "/v1/{parent=shelves/*}/books:search"}},
+		},
+	})
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+		if len(typeName) > 0 {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("library.proto"),
+		Package: proto.String("library"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("title", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+			{
+				Name: proto.String("CreateBookRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("parent", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("book", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".library.Book"),
+					field("limit", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Library"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("CreateBook"),
+						InputType:  proto.String(".library.CreateBookRequest"),
+						OutputType: proto.String(".library.Book"),
+						Options:    opts,
+					},
+				},
+			},
+		},
+	}
+
+	fd, err := desc.CreateFileDescriptor(fdp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd
+}
+
+func TestGateway(t *testing.T) {
+	srv, err := mock.NewServer([]*desc.FileDescriptor{testFile(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.SetRule("library.Library", "CreateBook", &mock.MethodRule{
+		Response: json.RawMessage(`{"title": "go"}`),
+		Header:   map[string]string{"x-id": "1"},
+	})
+	port, err := srv.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	cli := stub.NewStub("127.0.0.1", port)
+	if err = cli.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := New()
+	gw.Register(cli)
+	if routes := gw.Routes(); len(routes) != 2 {
+		t.Fatalf("routes %v", len(routes))
+	}
+
+	// body 映射到 book 字段, 路径变量映射到 parent
+	route, values, ok := gw.find(http.MethodPost, "/v1/shelves/1/books")
+	if !ok || values["parent"] != "shelves/1" {
+		t.Fatalf("match %v %v", ok, values)
+	}
+	request, err := route.buildRequest(values, map[string][]string{"limit": {"5"}}, []byte(`{"title": "go"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(request) != `{"book":{"title":"go"},"limit":5,"parent":"shelves/1"}` {
+		t.Fatal(string(request))
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/gw/v1/shelves/1/books:search?limit=3", nil)
+	gw.Handle(w, r, strings.TrimPrefix(r.URL.Path, "/gw"))
+	if w.Code != http.StatusOK || w.Body.String() != `{"title":"go"}` {
+		t.Fatalf("%v %v", w.Code, w.Body.String())
+	}
+	if w.Header().Get(MetadataHeaderPrefix+"x-id") != "1" {
+		t.Fatal(w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	gw.Handle(w, httptest.NewRequest(http.MethodDelete, "/gw/v1/shelves/1", nil), "/v1/shelves/1")
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code)
+	}
+}
+
+func TestIncomingMetadata(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer tool")
+	header.Set(MetadataHeaderPrefix+"Authorization", "Bearer backend")
+	header.Set(MetadataHeaderPrefix+"X-Id", "1")
+
+	if md := incomingMetadata(header, false); md["authorization"] != "Bearer backend" || md["x-id"] != "1" {
+		t.Errorf("metadata %v", md)
+	}
+
+	header.Del(MetadataHeaderPrefix + "Authorization")
+	if md := incomingMetadata(header, true); md["authorization"] != "Bearer tool" {
+		t.Errorf("forward authorization %v", md)
+	}
+	if md := incomingMetadata(header, false); len(md["authorization"]) > 0 {
+		t.Errorf("strip authorization %v", md)
+	}
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// https://github.com/googleapis/googleapis/blob/master/google/api/http.proto
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	Verb     = ":" LITERAL ;
+
+const (
+	segmentLiteral = iota
+	segmentStar
+	segmentDoubleStar
+)
+
+type segment struct {
+	kind  int
+	value string
+}
+
+type variable struct {
+	fieldPath  string
+	start, end int // segments[start:end]
+}
+
+type pathTemplate struct {
+	raw       string
+	segments  []segment
+	variables []variable
+	verb      string
+}
+
+func parseTemplate(raw string) (*pathTemplate, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("template %v: must start with /", raw)
+	}
+
+	tmpl := &pathTemplate{raw: raw}
+	path := raw[1:]
+
+	// verb在最后一个变量之后
+	if i := strings.LastIndex(path, ":"); i >= 0 && i > strings.LastIndex(path, "}") {
+		tmpl.verb = path[i+1:]
+		path = path[:i]
+	}
+
+	for len(path) > 0 {
+		if path[0] == '{' {
+			end := strings.Index(path, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("template %v: missing }", raw)
+			}
+
+			inner := path[1:end]
+			path = strings.TrimPrefix(path[end+1:], "/")
+
+			fieldPath, pattern, ok := strings.Cut(inner, "=")
+			if !ok {
+				pattern = "*"
+			}
+
+			v := variable{fieldPath: fieldPath, start: len(tmpl.segments)}
+			for _, s := range strings.Split(pattern, "/") {
+				tmpl.segments = append(tmpl.segments, newSegment(s))
+			}
+			v.end = len(tmpl.segments)
+			tmpl.variables = append(tmpl.variables, v)
+			continue
+		}
+
+		s, rest, _ := strings.Cut(path, "/")
+		path = rest
+		if len(s) == 0 {
+			return nil, fmt.Errorf("template %v: empty segment", raw)
+		}
+		tmpl.segments = append(tmpl.segments, newSegment(s))
+	}
+
+	for i, s := range tmpl.segments {
+		if s.kind == segmentDoubleStar && i != len(tmpl.segments)-1 {
+			return nil, fmt.Errorf("template %v: ** must be the last segment", raw)
+		}
+	}
+
+	return tmpl, nil
+}
+
+func newSegment(s string) segment {
+	switch s {
+	case "*":
+		return segment{kind: segmentStar}
+	case "**":
+		return segment{kind: segmentDoubleStar}
+	}
+
+	return segment{kind: segmentLiteral, value: s}
+}
+
+// match 匹配请求路径, 返回变量 fieldPath -> value
+func (tis *pathTemplate) match(path string) (map[string]string, bool) {
+	path = strings.TrimPrefix(path, "/")
+
+	if len(tis.verb) > 0 {
+		if !strings.HasSuffix(path, ":"+tis.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+tis.verb)
+	}
+
+	var parts []string
+	if len(path) > 0 {
+		parts = strings.Split(path, "/")
+	}
+
+	n := len(tis.segments)
+	deep := n > 0 && tis.segments[n-1].kind == segmentDoubleStar
+	if deep {
+		if len(parts) < n-1 {
+			return nil, false
+		}
+	} else if len(parts) != n {
+		return nil, false
+	}
+
+	for i, s := range tis.segments {
+		if s.kind == segmentDoubleStar {
+			break
+		}
+		if s.kind == segmentLiteral && s.value != parts[i] {
+			return nil, false
+		}
+	}
+
+	values := map[string]string{}
+	for _, v := range tis.variables {
+		end := v.end
+		if deep && end == n {
+			end = len(parts)
+		}
+
+		if end-v.start == 1 {
+			value, err := url.PathUnescape(parts[v.start])
+			if err != nil {
+				return nil, false
+			}
+			values[v.fieldPath] = value
+		} else {
+			values[v.fieldPath] = strings.Join(parts[v.start:end], "/")
+		}
+	}
+
+	return values, true
+}
@@ -0,0 +1,225 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	KindGrpc = "grpc"
+	KindHttp = "http"
+)
+
+// Record 一次调用的记录, stream调用的每条消息依次保存
+type Record struct {
+	ID      int64     `json:"id"`
+	Session string    `json:"session,omitempty"` // 录制会话
+	Kind    string    `json:"kind"`              // grpc, http
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target"` // 127.0.0.1:50051
+	Service string    `json:"service,omitempty"`
+	Method  string    `json:"method"`
+
+	Header         map[string][]string `json:"header,omitempty"`
+	Requests       []json.RawMessage   `json:"requests,omitempty"`
+	ResponseHeader map[string][]string `json:"response_header,omitempty"`
+	Responses      []json.RawMessage   `json:"responses,omitempty"`
+	Trailer        map[string][]string `json:"trailer,omitempty"`
+
+	Code       int     `json:"code"` // grpc code 或 http status
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type Query struct {
+	Session string `form:"session"`
+	Kind    string `form:"kind"`
+	Service string `form:"service"`
+	Method  string `form:"method"`
+	Limit   int    `form:"limit"`
+}
+
+// Store 调用历史, 内存中保留最近max条, filename不为空时追加写入文件(json lines)
+type Store struct {
+	// Redact 不为空时保存前隐藏敏感内容
+	Redact func(record *Record)
+
+	filename string
+	max      int
+
+	records []*Record
+	nextID  int64
+	mux     sync.Mutex
+}
+
+func NewStore(filename string, max int) *Store {
+	tis := &Store{
+		filename: filename,
+		max:      max,
+		records:  []*Record{},
+		nextID:   1,
+	}
+
+	tis.load()
+
+	return tis
+}
+
+// Open 切换保存的文件, 重新加载记录
+func (tis *Store) Open(filename string) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.filename = filename
+	tis.records = []*Record{}
+	tis.nextID = 1
+	tis.load()
+}
+
+func (tis *Store) load() {
+	if len(tis.filename) == 0 {
+		return
+	}
+
+	f, err := os.Open(tis.filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		tis.append(&record)
+		if record.ID >= tis.nextID {
+			tis.nextID = record.ID + 1
+		}
+	}
+}
+
+func (tis *Store) append(record *Record) {
+	tis.records = append(tis.records, record)
+	if tis.max > 0 && len(tis.records) > tis.max {
+		tis.records = tis.records[len(tis.records)-tis.max:]
+	}
+}
+
+// Add 保存记录, 返回分配的ID
+func (tis *Store) Add(record *Record) int64 {
+	if tis.Redact != nil {
+		tis.Redact(record)
+	}
+
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	record.ID = tis.nextID
+	tis.nextID++
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	tis.append(record)
+
+	if len(tis.filename) > 0 {
+		data, err := json.Marshal(record)
+		if err != nil {
+			log.Println(err)
+			return record.ID
+		}
+
+		f, err := os.OpenFile(tis.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Println(err)
+			return record.ID
+		}
+		defer f.Close()
+
+		_, _ = f.Write(append(data, '\n'))
+	}
+
+	return record.ID
+}
+
+// Get 查找记录
+func (tis *Store) Get(id int64) (*Record, bool) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	for _, record := range tis.records {
+		if record.ID == id {
+			return record, true
+		}
+	}
+
+	return nil, false
+}
+
+// Find 按条件查找, 按时间先后排序, Limit大于0时返回最近的Limit条
+func (tis *Store) Find(q Query) []*Record {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	var result []*Record
+	for _, record := range tis.records {
+		if len(q.Session) > 0 && record.Session != q.Session {
+			continue
+		}
+		if len(q.Kind) > 0 && record.Kind != q.Kind {
+			continue
+		}
+		if len(q.Service) > 0 && record.Service != q.Service {
+			continue
+		}
+		if len(q.Method) > 0 && record.Method != q.Method {
+			continue
+		}
+
+		result = append(result, record)
+	}
+
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+
+	return result
+}
+
+// Sessions 全部录制会话
+func (tis *Store) Sessions() []string {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	var result []string
+	seen := map[string]bool{}
+	for _, record := range tis.records {
+		if len(record.Session) == 0 || seen[record.Session] {
+			continue
+		}
+
+		seen[record.Session] = true
+		result = append(result, record.Session)
+	}
+
+	return result
+}
+
+// Clear 清空历史
+func (tis *Store) Clear() {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.records = []*Record{}
+	if len(tis.filename) > 0 {
+		_ = os.Remove(tis.filename)
+	}
+}
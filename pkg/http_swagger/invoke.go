@@ -0,0 +1,124 @@
+package http_swagger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// InvokeRequest 调用http接口的参数
+type InvokeRequest struct {
+	Params map[string]any    `json:"params"` // 按参数声明的位置填入 path, query, header, cookie, formData; 未声明的作为query
+	Header map[string]string `json:"header"` // 附加的请求头
+	Data   json.RawMessage   `json:"data"`   // 请求body
+}
+
+// NewRequest 按method的参数定义生成请求, 请求地址为 String() + method.Path
+func (tis *JsonAPI) NewRequest(ctx context.Context, method *JsonMethod, request *InvokeRequest) (*http.Request, error) {
+	params := map[string]any{}
+	for k, v := range request.Params {
+		params[k] = v
+	}
+
+	path := method.Path
+	query := url.Values{}
+	form := url.Values{}
+	header := http.Header{}
+	var cookies []*http.Cookie
+
+	for _, p := range method.Parameters {
+		value, ok := params[p.Name]
+		delete(params, p.Name)
+		if !ok || value == nil {
+			if p.Required && p.In != "body" {
+				return nil, fmt.Errorf("missing required %v parameter %v", p.In, p.Name)
+			}
+			continue
+		}
+
+		values := paramValues(value)
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(strings.Join(values, ",")))
+		case "query":
+			query[p.Name] = append(query[p.Name], values...)
+		case "header":
+			header.Set(p.Name, strings.Join(values, ","))
+		case "cookie":
+			cookies = append(cookies, &http.Cookie{Name: p.Name, Value: strings.Join(values, ",")})
+		case "formData":
+			form[p.Name] = append(form[p.Name], values...)
+		}
+	}
+
+	// 未声明的参数
+	for k, v := range params {
+		query[k] = append(query[k], paramValues(v)...)
+	}
+
+	uri := tis.String() + path
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	contentType := method.ContentType
+	if len(form) > 0 {
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else if data := bytes.TrimSpace(request.Data); len(data) > 0 && !bytes.Equal(data, []byte("null")) {
+		body = bytes.NewReader(data)
+		if len(contentType) == 0 {
+			contentType = "application/json"
+		}
+	} else {
+		contentType = ""
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method.Method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	for k, v := range request.Header {
+		req.Header.Set(k, v)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if len(contentType) > 0 && len(req.Header.Get("Content-Type")) == 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return req, nil
+}
+
+// paramValues 参数值转为字符串, 数组为多个值
+func paramValues(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var values []string
+		for _, item := range v {
+			values = append(values, paramValues(item)...)
+		}
+		return values
+	case map[string]any:
+		data, _ := json.Marshal(v)
+		return []string{string(data)}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	}
+
+	return []string{fmt.Sprint(value)}
+}
@@ -1,89 +1,319 @@
 package http_swagger
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/getkin/kin-openapi/openapi3"
 	"log"
+	"net"
 	"net/http"
-	"net/netip"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
 )
 
 const (
 	Definitions = "#/definitions/"        // v2
 	Components  = "#/components/schemas/" // v3
+
+	ParametersV2 = "#/parameters/"            // v2
+	ParametersV3 = "#/components/parameters/" // v3
 )
 
+// 导入的操作, 按此顺序排列
+var operationMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodHead,
+	http.MethodOptions,
+}
+
 type JsonAPI struct {
 	Scheme   string       `json:"scheme"`   // http
-	Host     string       `json:"host"`     // 127.0.0.1
+	Host     string       `json:"host"`     // 127.0.0.1, api.example.com
 	Port     int          `json:"port"`     // 8080
 	BashPath string       `json:"bashPath"` // /bvcr/v1
 	Methods  []JsonMethod `json:"methods"`
 }
 
 func (tis *JsonAPI) String() string {
-	return fmt.Sprintf("%v://%v:%v%v", tis.Scheme, tis.Host, tis.Port, tis.BashPath)
+	return fmt.Sprintf("%v://%v%v", tis.Scheme, net.JoinHostPort(tis.Host, strconv.Itoa(tis.Port)), tis.BashPath)
+}
+
+// GetMethod 按路径和http方法查找, httpMethod为空时返回该路径的第一个操作
+func (tis *JsonAPI) GetMethod(path, httpMethod string) (*JsonMethod, bool) {
+	for i := range tis.Methods {
+		method := &tis.Methods[i]
+		if method.Path != path {
+			continue
+		}
+		if len(httpMethod) == 0 || strings.EqualFold(method.Method, httpMethod) {
+			return method, true
+		}
+	}
+
+	return nil, false
 }
 
 type JsonMethod struct {
-	Path   string `json:"path"`   // /crearo/filter
-	Method string `json:"method"` // get, post, delete, put
-	Input  string `json:"input"`  // json schema
-	Output string `json:"output"` // json schema
+	Path        string          `json:"path"`                  // /crearo/filter
+	Method      string          `json:"method"`                // GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS
+	OperationID string          `json:"operationId,omitempty"` //
+	Summary     string          `json:"summary,omitempty"`     //
+	Parameters  []JsonParameter `json:"parameters,omitempty"`  // path, query, header 等参数
+	ContentType string          `json:"contentType,omitempty"` // body的类型
+	Input       string          `json:"input"`                 // json schema
+	Output      string          `json:"output"`                // json schema
 }
 
-// ParseSwagger 解析swagger.json文件
+type JsonParameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"` // path, query, header, cookie, formData
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema,omitempty"` // json schema
+}
+
+// ParseSwagger 解析swagger文档, json或yaml
 func ParseSwagger(data []byte) (*JsonAPI, error) {
-	v, err := parseSwaggerV2(data)
-	if err == nil {
-		return v, nil
+	if !json.Valid(data) {
+		var err error
+		if data, err = yamlToJson(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var version struct {
+		Swagger string `json:"swagger"`
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+
+	if len(version.Swagger) > 0 {
+		return parseSwaggerV2(data)
+	} else if len(version.OpenAPI) > 0 {
+		return parseSwaggerV3(data)
+	}
+
+	return nil, fmt.Errorf("unknown document, neither swagger nor openapi")
+}
+
+func yamlToJson(data []byte) ([]byte, error) {
+	var object any
+	if err := yaml.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(stringKeys(object))
+}
+
+// stringKeys yaml中的 200: 等非字符串key转为字符串
+func stringKeys(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = stringKeys(item)
+		}
+		return val
+	case map[any]any:
+		m := make(map[string]any, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = stringKeys(item)
+		}
+		return m
+	case []any:
+		for i, item := range val {
+			val[i] = stringKeys(item)
+		}
+		return val
 	}
 
-	return parseSwaggerV3(data)
+	return v
 }
 
-func extendSchemaRefV2(schema *openapi3.SchemaRef, s *openapi2.T) *openapi3.SchemaRef {
-	if schema == nil || s == nil {
+// schemaResolver 展开$ref, 递归引用保留为$ref
+type schemaResolver struct {
+	lookup func(ref string) (*openapi3.SchemaRef, bool)
+}
+
+func (tis *schemaResolver) resolve(schema *openapi3.SchemaRef) *openapi3.SchemaRef {
+	return tis.resolveRef(schema, map[string]bool{})
+}
+
+func (tis *schemaResolver) resolveRef(schema *openapi3.SchemaRef, visiting map[string]bool) *openapi3.SchemaRef {
+	if schema == nil {
 		return nil
 	}
+
 	if len(schema.Ref) != 0 {
-		key := strings.TrimPrefix(schema.Ref, Definitions)
-		if v, ok := s.Definitions[key]; ok {
-			schema.Ref = ""
-			schema.Value = v.Value
+		target, ok := tis.lookup(schema.Ref)
+		if !ok || visiting[schema.Ref] {
+			return &openapi3.SchemaRef{Ref: schema.Ref}
 		}
+
+		visiting[schema.Ref] = true
+		defer delete(visiting, schema.Ref)
+
+		return tis.resolveRef(target, visiting)
 	}
 
-	extendSchemaRefV2(schema.Value.Items, s)
+	if schema.Value == nil {
+		return nil
+	}
 
-	for _, ref := range schema.Value.Properties {
-		extendSchemaRefV2(ref, s)
+	// 复制, 不修改文档中共享的定义
+	value := *schema.Value
+	value.Items = tis.resolveRef(value.Items, visiting)
+	value.Not = tis.resolveRef(value.Not, visiting)
+	value.AdditionalProperties = tis.resolveRef(value.AdditionalProperties, visiting)
+	value.AllOf = tis.resolveList(value.AllOf, visiting)
+	value.OneOf = tis.resolveList(value.OneOf, visiting)
+	value.AnyOf = tis.resolveList(value.AnyOf, visiting)
+
+	if value.Properties != nil {
+		properties := openapi3.Schemas{}
+		for k, v := range value.Properties {
+			properties[k] = tis.resolveRef(v, visiting)
+		}
+		value.Properties = properties
 	}
 
-	return schema
+	return &openapi3.SchemaRef{Value: &value}
 }
 
-func parseSwaggerV2(data []byte) (*JsonAPI, error) {
-	s2 := openapi2.T{}
-	if err := s2.UnmarshalJSON(data); err != nil {
-		return nil, err
+func (tis *schemaResolver) resolveList(list openapi3.SchemaRefs, visiting map[string]bool) openapi3.SchemaRefs {
+	if list == nil {
+		return nil
 	}
 
-	s2.Host = strings.ReplaceAll(s2.Host, "localhost", "127.0.0.1")
-	addr, err := netip.ParseAddrPort(s2.Host)
+	result := openapi3.SchemaRefs{}
+	for _, item := range list {
+		if v := tis.resolveRef(item, visiting); v != nil {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func (tis *schemaResolver) marshal(schema *openapi3.SchemaRef) string {
+	resolved := tis.resolve(schema)
+	if resolved == nil {
+		return ""
+	}
+
+	data, err := resolved.MarshalJSON()
 	if err != nil {
+		log.Println(err)
+		return ""
+	}
+
+	return string(data)
+}
+
+// splitHost 解析 host[:port], 无端口时按scheme使用默认端口
+func splitHost(scheme, host string) (string, int, error) {
+	host = strings.ReplaceAll(host, "localhost", "127.0.0.1")
+	if len(host) == 0 {
+		return "", 0, fmt.Errorf("no host")
+	}
+
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port [%v]", p)
+		}
+		return h, port, nil
+	}
+
+	port := 80
+	if scheme == "https" {
+		port = 443
+	}
+
+	return strings.Trim(host, "[]"), port, nil
+}
+
+// successCodes 按状态码排序的2xx回复
+func successCodes(codes []string) []string {
+	var result []string
+	for _, responseCode := range codes {
+		if code, err := strconv.Atoi(responseCode); err != nil {
+			continue
+		} else if code >= http.StatusOK && code < http.StatusMultipleChoices {
+			result = append(result, responseCode)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// jsonMediaType 优先选择json类型
+func jsonMediaType(content openapi3.Content) (string, *openapi3.MediaType) {
+	var keys []string
+	for k := range content {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k == "application/json" {
+			return k, content[k]
+		}
+	}
+	for _, k := range keys {
+		if strings.HasSuffix(k, "+json") || strings.Contains(k, "json") {
+			return k, content[k]
+		}
+	}
+	if len(keys) > 0 {
+		return keys[0], content[keys[0]]
+	}
+
+	return "", nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func operationsV2(item *openapi2.PathItem) map[string]*openapi2.Operation {
+	return map[string]*openapi2.Operation{
+		http.MethodGet:     item.Get,
+		http.MethodPost:    item.Post,
+		http.MethodPut:     item.Put,
+		http.MethodPatch:   item.Patch,
+		http.MethodDelete:  item.Delete,
+		http.MethodHead:    item.Head,
+		http.MethodOptions: item.Options,
+	}
+}
+
+func parseSwaggerV2(data []byte) (*JsonAPI, error) {
+	s2 := openapi2.T{}
+	if err := s2.UnmarshalJSON(data); err != nil {
 		return nil, err
 	}
 
 	var api = &JsonAPI{
 		Scheme:   "http",
-		Host:     addr.Addr().String(),
-		Port:     int(addr.Port()),
 		BashPath: s2.BasePath,
 		Methods:  []JsonMethod{},
 	}
@@ -91,87 +321,132 @@ func parseSwaggerV2(data []byte) (*JsonAPI, error) {
 		api.Scheme = s2.Schemes[0]
 	}
 
-	var updateMethod = func(obj *JsonMethod, src *openapi2.Operation) {
+	host, port, err := splitHost(api.Scheme, s2.Host)
+	if err != nil {
+		return nil, err
+	}
+	api.Host, api.Port = host, port
 
-		for _, parameter := range src.Parameters {
-			if parameter.Schema == nil {
-				continue
+	resolver := &schemaResolver{
+		lookup: func(ref string) (*openapi3.SchemaRef, bool) {
+			if !strings.HasPrefix(ref, Definitions) {
+				return nil, false
 			}
+			v, ok := s2.Definitions[strings.TrimPrefix(ref, Definitions)]
+			return v, ok && v != nil
+		},
+	}
+
+	var lookupParameter = func(parameter *openapi2.Parameter) *openapi2.Parameter {
+		if parameter == nil || len(parameter.Ref) == 0 {
+			return parameter
+		}
+		return s2.Parameters[strings.TrimPrefix(parameter.Ref, ParametersV2)]
+	}
+
+	var updateMethod = func(obj *JsonMethod, src *openapi2.Operation, common openapi2.Parameters) {
+		obj.OperationID = src.OperationID
+		obj.Summary = src.Summary
+
+		obj.ContentType = "application/json"
+		if len(src.Consumes) > 0 {
+			obj.ContentType = src.Consumes[0]
+		} else if len(s2.Consumes) > 0 {
+			obj.ContentType = s2.Consumes[0]
+		}
+
+		// 操作的参数覆盖路径的同名参数
+		parameters := map[string]*openapi2.Parameter{}
+		var order []string
+		for _, list := range []openapi2.Parameters{common, src.Parameters} {
+			for _, p := range list {
+				parameter := lookupParameter(p)
+				if parameter == nil {
+					continue
+				}
 
-			parameter.Schema = extendSchemaRefV2(parameter.Schema, &s2)
-			if data, err := parameter.Schema.MarshalJSON(); err == nil {
-				obj.Input = string(data)
+				key := parameter.In + ":" + parameter.Name
+				if _, ok := parameters[key]; !ok {
+					order = append(order, key)
+				}
+				parameters[key] = parameter
 			}
 		}
 
-		for responseCode, response := range src.Responses {
-			if response.Schema == nil {
+		for _, key := range order {
+			parameter := parameters[key]
+			if parameter.In == "body" {
+				obj.Input = resolver.marshal(parameter.Schema)
 				continue
 			}
-			if code, err := strconv.Atoi(responseCode); err != nil {
-				log.Println(err)
-				continue
-			} else if code >= http.StatusOK && code < http.StatusMultipleChoices {
-				// 成功, 继续
-			} else {
-				log.Println(code)
-				continue
+
+			schema := parameter.Schema
+			if schema == nil {
+				schema = openapi3.NewSchemaRef("", &openapi3.Schema{
+					Type:    parameter.Type,
+					Format:  parameter.Format,
+					Enum:    parameter.Enum,
+					Items:   parameter.Items,
+					Default: parameter.Default,
+				})
 			}
 
-			response.Schema = extendSchemaRefV2(response.Schema, &s2)
-			if data, err := response.Schema.MarshalJSON(); err == nil {
-				obj.Output = string(data)
+			obj.Parameters = append(obj.Parameters, JsonParameter{
+				Name:        parameter.Name,
+				In:          parameter.In,
+				Required:    parameter.Required,
+				Description: parameter.Description,
+				Schema:      resolver.marshal(schema),
+			})
+		}
+
+		for _, responseCode := range successCodes(sortedKeys(src.Responses)) {
+			response := src.Responses[responseCode]
+			if response == nil || response.Schema == nil {
+				continue
 			}
+
+			obj.Output = resolver.marshal(response.Schema)
+			break
 		}
 	}
 
-	for methodPath, item := range s2.Paths {
-		var obj = JsonMethod{
-			Path:   methodPath,
-			Method: http.MethodGet,
-			Input:  "",
-			Output: "",
+	for _, methodPath := range sortedKeys(s2.Paths) {
+		item := s2.Paths[methodPath]
+		if item == nil {
+			continue
 		}
 
-		if item.Get != nil {
-			obj.Method = http.MethodGet
-			updateMethod(&obj, item.Get)
-		} else if item.Post != nil {
-			obj.Method = http.MethodPost
-			updateMethod(&obj, item.Post)
-		} else if item.Put != nil {
-			obj.Method = http.MethodPut
-			updateMethod(&obj, item.Put)
-		} else if item.Delete != nil {
-			obj.Method = http.MethodDelete
-			updateMethod(&obj, item.Delete)
-		}
+		operations := operationsV2(item)
+		for _, httpMethod := range operationMethods {
+			operation := operations[httpMethod]
+			if operation == nil {
+				continue
+			}
+
+			var obj = JsonMethod{
+				Path:   methodPath,
+				Method: httpMethod,
+			}
+			updateMethod(&obj, operation, item.Parameters)
 
-		api.Methods = append(api.Methods, obj)
+			api.Methods = append(api.Methods, obj)
+		}
 	}
 
 	return api, nil
 }
 
-func extendSchemaRefV3(schema *openapi3.SchemaRef, s *openapi3.T) *openapi3.SchemaRef {
-	if schema == nil || s == nil {
-		return nil
-	}
-	if len(schema.Ref) != 0 {
-		key := strings.TrimPrefix(schema.Ref, Components)
-		if v, ok := s.Components.Schemas[key]; ok {
-			schema.Ref = ""
-			schema.Value = v.Value
+// serverURL 替换服务地址中的变量
+func serverURL(server *openapi3.Server) string {
+	uri := server.URL
+	for name, variable := range server.Variables {
+		if variable != nil {
+			uri = strings.ReplaceAll(uri, "{"+name+"}", variable.Default)
 		}
 	}
 
-	extendSchemaRefV3(schema.Value.Items, s)
-
-	for _, ref := range schema.Value.Properties {
-		extendSchemaRefV3(ref, s)
-	}
-
-	return schema
+	return uri
 }
 
 func parseSwaggerV3(data []byte) (*JsonAPI, error) {
@@ -180,93 +455,143 @@ func parseSwaggerV3(data []byte) (*JsonAPI, error) {
 		return nil, err
 	}
 
-	if len(s2.Servers) == 0 {
+	if len(s2.Servers) == 0 || s2.Servers[0] == nil {
 		return nil, fmt.Errorf("no Servers")
 	}
 
-	s2.Servers[0].URL = strings.ReplaceAll(s2.Servers[0].URL, "localhost", "127.0.0.1")
-	urlInfo, err := url.Parse(s2.Servers[0].URL)
-	if err != nil {
-		return nil, err
-	}
-
-	addr, err := netip.ParseAddrPort(urlInfo.Host)
+	urlInfo, err := url.Parse(serverURL(s2.Servers[0]))
 	if err != nil {
 		return nil, err
 	}
 
 	var api = &JsonAPI{
 		Scheme:   urlInfo.Scheme,
-		Host:     addr.Addr().String(),
-		Port:     int(addr.Port()),
 		BashPath: urlInfo.Path,
 		Methods:  []JsonMethod{},
 	}
+	if len(api.Scheme) == 0 {
+		api.Scheme = "http"
+	}
 
-	var updateMethod = func(obj *JsonMethod, src *openapi3.Operation) {
-		if src.RequestBody != nil && src.RequestBody.Value != nil {
-			for _, mediaType := range src.RequestBody.Value.Content {
-				if mediaType.Schema == nil {
+	host, port, err := splitHost(api.Scheme, urlInfo.Host)
+	if err != nil {
+		return nil, err
+	}
+	api.Host, api.Port = host, port
+
+	resolver := &schemaResolver{
+		lookup: func(ref string) (*openapi3.SchemaRef, bool) {
+			if !strings.HasPrefix(ref, Components) {
+				return nil, false
+			}
+			v, ok := s2.Components.Schemas[strings.TrimPrefix(ref, Components)]
+			return v, ok && v != nil
+		},
+	}
+
+	var lookupParameter = func(parameter *openapi3.ParameterRef) *openapi3.Parameter {
+		if parameter == nil {
+			return nil
+		}
+		if len(parameter.Ref) == 0 {
+			return parameter.Value
+		}
+		if v, ok := s2.Components.Parameters[strings.TrimPrefix(parameter.Ref, ParametersV3)]; ok && v != nil {
+			return v.Value
+		}
+		return nil
+	}
+
+	var updateMethod = func(obj *JsonMethod, src *openapi3.Operation, common openapi3.Parameters) {
+		obj.OperationID = src.OperationID
+		obj.Summary = src.Summary
+
+		parameters := map[string]*openapi3.Parameter{}
+		var order []string
+		for _, list := range []openapi3.Parameters{common, src.Parameters} {
+			for _, p := range list {
+				parameter := lookupParameter(p)
+				if parameter == nil {
 					continue
 				}
 
-				mediaType.Schema = extendSchemaRefV3(mediaType.Schema, &s2)
-				if data, err := mediaType.Schema.MarshalJSON(); err == nil {
-					obj.Input = string(data)
+				key := parameter.In + ":" + parameter.Name
+				if _, ok := parameters[key]; !ok {
+					order = append(order, key)
 				}
+				parameters[key] = parameter
 			}
 		}
 
-		for responseCode, response := range src.Responses {
-			if response.Value == nil || response.Value.Content == nil {
-				continue
-			}
-			if code, err := strconv.Atoi(responseCode); err != nil {
-				log.Println(err)
-				continue
-			} else if code >= http.StatusOK && code < http.StatusMultipleChoices {
-				// 成功, 继续
-			} else {
-				log.Println(code)
-				continue
+		for _, key := range order {
+			parameter := parameters[key]
+
+			schema := parameter.Schema
+			if schema == nil {
+				if _, mediaType := jsonMediaType(parameter.Content); mediaType != nil {
+					schema = mediaType.Schema
+				}
 			}
 
-			for _, mediaType := range response.Value.Content {
-				if mediaType.Schema == nil {
-					continue
+			obj.Parameters = append(obj.Parameters, JsonParameter{
+				Name:        parameter.Name,
+				In:          parameter.In,
+				Required:    parameter.Required,
+				Description: parameter.Description,
+				Schema:      resolver.marshal(schema),
+			})
+		}
+
+		if src.RequestBody != nil {
+			requestBody := src.RequestBody.Value
+			if len(src.RequestBody.Ref) > 0 {
+				if v, ok := s2.Components.RequestBodies[strings.TrimPrefix(src.RequestBody.Ref, "#/components/requestBodies/")]; ok && v != nil {
+					requestBody = v.Value
 				}
+			}
 
-				mediaType.Schema = extendSchemaRefV3(mediaType.Schema, &s2)
-				if data, err := mediaType.Schema.MarshalJSON(); err == nil {
-					obj.Output = string(data)
+			if requestBody != nil {
+				if contentType, mediaType := jsonMediaType(requestBody.Content); mediaType != nil {
+					obj.ContentType = contentType
+					obj.Input = resolver.marshal(mediaType.Schema)
 				}
 			}
 		}
-	}
 
-	for methodPath, item := range s2.Paths {
-		var obj = JsonMethod{
-			Path:   methodPath,
-			Method: http.MethodGet,
-			Input:  "",
-			Output: "",
+		for _, responseCode := range successCodes(sortedKeys(src.Responses)) {
+			response := src.Responses[responseCode]
+			if response == nil || response.Value == nil {
+				continue
+			}
+
+			if _, mediaType := jsonMediaType(response.Value.Content); mediaType != nil && mediaType.Schema != nil {
+				obj.Output = resolver.marshal(mediaType.Schema)
+				break
+			}
 		}
+	}
 
-		if item.Get != nil {
-			obj.Method = http.MethodGet
-			updateMethod(&obj, item.Get)
-		} else if item.Post != nil {
-			obj.Method = http.MethodPost
-			updateMethod(&obj, item.Post)
-		} else if item.Put != nil {
-			obj.Method = http.MethodPut
-			updateMethod(&obj, item.Put)
-		} else if item.Delete != nil {
-			obj.Method = http.MethodDelete
-			updateMethod(&obj, item.Delete)
+	for _, methodPath := range sortedKeys(s2.Paths) {
+		item := s2.Paths[methodPath]
+		if item == nil {
+			continue
 		}
 
-		api.Methods = append(api.Methods, obj)
+		operations := item.Operations()
+		for _, httpMethod := range operationMethods {
+			operation := operations[httpMethod]
+			if operation == nil {
+				continue
+			}
+
+			var obj = JsonMethod{
+				Path:   methodPath,
+				Method: httpMethod,
+			}
+			updateMethod(&obj, operation, item.Parameters)
+
+			api.Methods = append(api.Methods, obj)
+		}
 	}
 
 	return api, nil
@@ -1,9 +1,13 @@
 package http_swagger
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"testing"
 )
 
 func ExampleParseSwagger() {
@@ -23,3 +27,198 @@ func ExampleParseSwagger() {
 
 	// output:
 }
+
+const testSwaggerV2 = `{
+  "swagger": "2.0",
+  "host": "api.example.com",
+  "basePath": "/v1",
+  "schemes": ["https"],
+  "parameters": {
+    "limit": {"name": "limit", "in": "query", "type": "integer"}
+  },
+  "paths": {
+    "/nodes/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "type": "string"}],
+      "get": {
+        "parameters": [{"$ref": "#/parameters/limit"}, {"name": "X-Token", "in": "header", "type": "string"}],
+        "responses": {
+          "404": {"description": "", "schema": {"type": "string"}},
+          "200": {"description": "", "schema": {"$ref": "#/definitions/Node"}}
+        }
+      },
+      "patch": {
+        "parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Node"}}],
+        "responses": {"204": {"description": ""}}
+      },
+      "delete": {"responses": {"200": {"description": ""}}}
+    }
+  },
+  "definitions": {
+    "Node": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "children": {"type": "array", "items": {"$ref": "#/definitions/Node"}},
+        "meta": {"allOf": [{"$ref": "#/definitions/Meta"}]}
+      }
+    },
+    "Meta": {"type": "object", "properties": {"tag": {"type": "string"}}}
+  }
+}`
+
+const testSwaggerV3 = `{
+  "openapi": "3.0.0",
+  "info": {"title": "t", "version": "1"},
+  "servers": [{"url": "{scheme}://localhost:{port}/api", "variables": {"scheme": {"default": "http"}, "port": {"default": "9000"}}}],
+  "paths": {
+    "/items": {
+      "get": {
+        "parameters": [{"name": "q", "in": "query", "schema": {"type": "string"}}],
+        "responses": {"200": {"description": "", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}}}}}}
+      },
+      "post": {
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+        "responses": {"201": {"description": "", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}}}
+      },
+      "head": {"responses": {"200": {"description": ""}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Item": {"type": "object", "properties": {"kind": {"oneOf": [{"$ref": "#/components/schemas/A"}, {"type": "string"}]}}},
+      "A": {"type": "object", "properties": {"parent": {"$ref": "#/components/schemas/Item"}}}
+    }
+  }
+}`
+
+func TestParseSwaggerV2(t *testing.T) {
+	api, err := ParseSwagger([]byte(testSwaggerV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if api.String() != "https://api.example.com:443/v1" {
+		t.Fatal(api.String())
+	}
+	if len(api.Methods) != 3 {
+		t.Fatalf("methods %v", len(api.Methods))
+	}
+
+	get, ok := api.GetMethod("/nodes/{id}", http.MethodGet)
+	if !ok {
+		t.Fatal("GET not found")
+	}
+	var names []string
+	for _, p := range get.Parameters {
+		names = append(names, p.In+":"+p.Name)
+	}
+	if strings.Join(names, ",") != "path:id,query:limit,header:X-Token" {
+		t.Fatal(names)
+	}
+
+	// 递归引用保留$ref, allOf中的引用展开
+	for _, want := range []string{`"$ref":"#/definitions/Node"`, `"tag"`} {
+		if !strings.Contains(get.Output, want) {
+			t.Fatalf("%v not in %v", want, get.Output)
+		}
+	}
+
+	patch, ok := api.GetMethod("/nodes/{id}", http.MethodPatch)
+	if !ok || !strings.Contains(patch.Input, `"children"`) {
+		t.Fatalf("PATCH %+v", patch)
+	}
+}
+
+func TestParseSwaggerV3(t *testing.T) {
+	api, err := ParseSwagger([]byte(testSwaggerV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if api.String() != "http://127.0.0.1:9000/api" {
+		t.Fatal(api.String())
+	}
+	if len(api.Methods) != 3 {
+		t.Fatalf("methods %v", len(api.Methods))
+	}
+
+	post, ok := api.GetMethod("/items", http.MethodPost)
+	if !ok || post.ContentType != "application/json" {
+		t.Fatalf("POST %+v", post)
+	}
+	if !strings.Contains(post.Input, `"$ref":"#/components/schemas/Item"`) || !strings.Contains(post.Output, `"oneOf"`) {
+		t.Fatalf("POST %+v", post)
+	}
+
+	if _, ok = api.GetMethod("/items", http.MethodHead); !ok {
+		t.Fatal("HEAD not found")
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	api, err := ParseSwagger([]byte(testSwaggerV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get, _ := api.GetMethod("/nodes/{id}", http.MethodGet)
+	if _, err = api.NewRequest(context.Background(), get, &InvokeRequest{}); err == nil {
+		t.Fatal("want missing parameter error")
+	}
+
+	req, err := api.NewRequest(context.Background(), get, &InvokeRequest{
+		Params: map[string]any{"id": "a/b", "limit": float64(10), "X-Token": "t", "tag": []any{"x", "y"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "https://api.example.com:443/v1/nodes/a%2Fb?limit=10&tag=x&tag=y" {
+		t.Fatal(req.URL.String())
+	}
+	if req.Header.Get("X-Token") != "t" || req.Body != nil {
+		t.Fatal(req.Header, req.Body)
+	}
+
+	patch, _ := api.GetMethod("/nodes/{id}", http.MethodPatch)
+	req, err = api.NewRequest(context.Background(), patch, &InvokeRequest{
+		Params: map[string]any{"id": "1"},
+		Data:   json.RawMessage(`{"name": "n"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodPatch || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatal(req.Method, req.Header)
+	}
+}
+
+func TestParseSwaggerYaml(t *testing.T) {
+	api, err := ParseSwagger([]byte(`
+openapi: 3.0.0
+info: {title: t, version: "1"}
+servers:
+  - url: https://api.example.com/v2
+paths:
+  /items/{id}:
+    get:
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: integer}}
+      responses:
+        200:
+          description: ok
+          content:
+            application/json:
+              schema: {type: object, properties: {id: {type: integer}}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if api.String() != "https://api.example.com:443/v2" {
+		t.Fatal(api.String())
+	}
+	get, ok := api.GetMethod("/items/{id}", http.MethodGet)
+	if !ok || !strings.Contains(get.Output, `"id"`) {
+		t.Fatalf("GET %+v", get)
+	}
+}
@@ -0,0 +1,136 @@
+package jsonpath
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Difference 路径上的值不完全相同, Values与输入的顺序一致
+type Difference struct {
+	Path    string `json:"path"`
+	Values  []any  `json:"values"`
+	Missing []int  `json:"missing,omitempty"` // 缺少该字段的输入下标, 对应的值为null
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Diff 比较多个json.Unmarshal得到的数据, 对象和数组逐层比较, 返回值不同的路径
+func Diff(values ...any) []Difference {
+	present := make([]bool, len(values))
+	for i := range present {
+		present[i] = true
+	}
+
+	var result []Difference
+	diff("$", values, present, &result)
+	return result
+}
+
+func diff(path string, values []any, present []bool, result *[]Difference) {
+	var missing []int
+	for i, ok := range present {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		if objects, ok := allObjects(values); ok {
+			keys := map[string]bool{}
+			for _, obj := range objects {
+				for key := range obj {
+					keys[key] = true
+				}
+			}
+			var sorted []string
+			for key := range keys {
+				sorted = append(sorted, key)
+			}
+			sort.Strings(sorted)
+
+			for _, key := range sorted {
+				child := make([]any, len(objects))
+				childPresent := make([]bool, len(objects))
+				for i, obj := range objects {
+					child[i], childPresent[i] = obj[key]
+				}
+				diff(path+keyPath(key), child, childPresent, result)
+			}
+			return
+		}
+
+		if arrays, ok := allArrays(values); ok {
+			n := 0
+			for _, arr := range arrays {
+				if len(arr) > n {
+					n = len(arr)
+				}
+			}
+
+			for index := 0; index < n; index++ {
+				child := make([]any, len(arrays))
+				childPresent := make([]bool, len(arrays))
+				for i, arr := range arrays {
+					if index < len(arr) {
+						child[i], childPresent[i] = arr[index], true
+					}
+				}
+				diff(fmt.Sprintf("%v[%v]", path, index), child, childPresent, result)
+			}
+			return
+		}
+
+		equal := true
+		for _, v := range values[1:] {
+			if !reflect.DeepEqual(v, values[0]) {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return
+		}
+	}
+
+	*result = append(*result, Difference{Path: path, Values: values, Missing: missing})
+}
+
+// keyPath 不是标识符的key使用['key'], 转义'和\
+func keyPath(key string) string {
+	if identifier.MatchString(key) {
+		return "." + key
+	}
+
+	return "['" + keyEscaper.Replace(key) + "']"
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func allObjects(values []any) ([]map[string]any, bool) {
+	var result []map[string]any
+	for _, v := range values {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, obj)
+	}
+
+	return result, true
+}
+
+func allArrays(values []any) ([][]any, bool) {
+	var result [][]any
+	for _, v := range values {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, arr)
+	}
+
+	return result, true
+}
@@ -0,0 +1,160 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 支持的语法: $.a.b, $.a[0], $['a'], $.a[*].b
+type token struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parse(path string) ([]token, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	var tokens []token
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in path")
+			}
+			key := path[:end]
+			if key == "*" {
+				tokens = append(tokens, token{wildcard: true})
+			} else {
+				tokens = append(tokens, token{key: key})
+			}
+			path = path[end:]
+		case '[':
+			if inner := strings.TrimLeft(path[1:], " "); len(inner) > 0 && (inner[0] == '\'' || inner[0] == '"') {
+				key, rest, err := parseQuoted(inner)
+				if err != nil {
+					return nil, err
+				}
+				rest = strings.TrimLeft(rest, " ")
+				if !strings.HasPrefix(rest, "]") {
+					return nil, fmt.Errorf("missing ]")
+				}
+				tokens = append(tokens, token{key: key})
+				path = rest[1:]
+				continue
+			}
+
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ]")
+			}
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+
+			if inner == "*" {
+				tokens = append(tokens, token{wildcard: true})
+			} else if n, err := strconv.Atoi(inner); err == nil {
+				tokens = append(tokens, token{index: n, isIndex: true})
+			} else {
+				return nil, fmt.Errorf("invalid index [%v]", inner)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected [%c]", path[0])
+		}
+	}
+
+	return tokens, nil
+}
+
+// parseQuoted 解析以'或"开始的key, \转义引号和\本身, 返回key和之后的内容
+func parseQuoted(path string) (string, string, error) {
+	quote := path[0]
+
+	var key strings.Builder
+	for i := 1; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			if i+1 < len(path) {
+				i++
+			}
+			key.WriteByte(path[i])
+		case quote:
+			return key.String(), path[i+1:], nil
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+
+	return "", "", fmt.Errorf("missing %c", quote)
+}
+
+// Get 在json.Unmarshal得到的数据中查找, 路径包含[*]时返回数组
+func Get(data any, path string) (any, error) {
+	tokens, err := parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("jsonpath %v: %v", path, err)
+	}
+
+	values := []any{data}
+	multiple := false
+	for _, tk := range tokens {
+		var next []any
+		for _, v := range values {
+			switch {
+			case tk.wildcard:
+				multiple = true
+				switch obj := v.(type) {
+				case []any:
+					next = append(next, obj...)
+				case map[string]any:
+					for _, item := range obj {
+						next = append(next, item)
+					}
+				}
+			case tk.isIndex:
+				arr, ok := v.([]any)
+				if !ok {
+					continue
+				}
+				i := tk.index
+				if i < 0 {
+					i += len(arr)
+				}
+				if i >= 0 && i < len(arr) {
+					next = append(next, arr[i])
+				}
+			default:
+				obj, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				if item, ok := obj[tk.key]; ok {
+					next = append(next, item)
+				}
+			}
+		}
+
+		values = next
+	}
+
+	if multiple {
+		if values == nil {
+			values = []any{}
+		}
+		return values, nil
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("jsonpath %v: not found", path)
+	}
+
+	return values[0], nil
+}
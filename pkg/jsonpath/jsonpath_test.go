@@ -0,0 +1,90 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	var data any
+	_ = json.Unmarshal([]byte(`{"user": {"id": "7", "tags": ["a", "b"]}, "items": [{"id": 1}, {"id": 2}]}`), &data)
+
+	tests := []struct {
+		path string
+		want any
+	}{
+		{"$.user.id", "7"},
+		{"$['user'].tags[1]", "b"},
+		{"$.user.tags[-1]", "b"},
+		{"$.items[*].id", []any{float64(1), float64(2)}},
+		{"$.items[0]", map[string]any{"id": float64(1)}},
+	}
+
+	for _, tt := range tests {
+		got, err := Get(data, tt.path)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.path, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%v: want %v, got %v", tt.path, tt.want, got)
+		}
+	}
+
+	if _, err := Get(data, "$.user.name"); err == nil {
+		t.Fatal("want not found")
+	}
+	if _, err := Get(data, "$.items["); err == nil {
+		t.Fatal("want syntax error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var a, b, c any
+	_ = json.Unmarshal([]byte(`{"name": "x", "version": "1.0", "tags": ["a"], "user": {"id": 1}, "a-b": 1}`), &a)
+	_ = json.Unmarshal([]byte(`{"name": "x", "version": "1.1", "tags": ["a", "b"], "user": {"id": 1}, "a-b": 1}`), &b)
+	_ = json.Unmarshal([]byte(`{"name": "x", "version": "1.0", "tags": ["a"], "user": "7", "a-b": 2}`), &c)
+
+	got := Diff(a, b, c)
+	want := []Difference{
+		{Path: "$['a-b']", Values: []any{float64(1), float64(1), float64(2)}},
+		{Path: "$.tags[1]", Values: []any{nil, "b", nil}, Missing: []int{0, 2}},
+		{Path: "$.user", Values: []any{map[string]any{"id": float64(1)}, map[string]any{"id": float64(1)}, "7"}},
+		{Path: "$.version", Values: []any{"1.0", "1.1", "1.0"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+
+	if got := Diff(a, a); len(got) != 0 {
+		t.Fatalf("want no difference, got %+v", got)
+	}
+}
+
+// TestDiffEscapedKeys key中的'和\转义后可以用Get取回
+func TestDiffEscapedKeys(t *testing.T) {
+	var a, b any
+	_ = json.Unmarshal([]byte(`{"it's": 1, "a\\b": 1, "x]y": 1}`), &a)
+	_ = json.Unmarshal([]byte(`{"it's": 2, "a\\b": 2, "x]y": 2}`), &b)
+
+	got := Diff(a, b)
+	want := []string{`$['a\\b']`, `$['it\'s']`, `$['x]y']`}
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %+v", want, got)
+	}
+	for i, d := range got {
+		if d.Path != want[i] {
+			t.Errorf("want %v, got %v", want[i], d.Path)
+		}
+		if v, err := Get(a, d.Path); err != nil || v != float64(1) {
+			t.Errorf("%v: %v %v", d.Path, v, err)
+		}
+	}
+
+	if v, err := Get(a, `$["it's"]`); err != nil || v != float64(1) {
+		t.Errorf("double quoted: %v %v", v, err)
+	}
+	if _, err := Get(a, `$['it\'s`); err == nil {
+		t.Error("want syntax error")
+	}
+}
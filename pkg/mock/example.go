@@ -0,0 +1,95 @@
+package mock
+
+import (
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// 嵌套消息的最大深度, 避免递归消息无限展开
+const exampleMaxDepth = 3
+
+// ExampleMessage 根据消息描述生成示例数据
+func ExampleMessage(md *desc.MessageDescriptor) *dynamic.Message {
+	return exampleMessage(md, 0)
+}
+
+func exampleMessage(md *desc.MessageDescriptor, depth int) *dynamic.Message {
+	msg := dynamic.NewMessage(md)
+	if depth >= exampleMaxDepth {
+		return msg
+	}
+
+	oneOfs := map[string]bool{}
+	for _, fd := range md.GetFields() {
+		// oneof只设置第一个字段
+		if oo := fd.GetOneOf(); oo != nil && !oo.IsSynthetic() {
+			if oneOfs[oo.GetName()] {
+				continue
+			}
+			oneOfs[oo.GetName()] = true
+		}
+
+		if fd.IsMap() {
+			key := exampleValue(fd.GetMapKeyType(), depth)
+			val := exampleValue(fd.GetMapValueType(), depth)
+			if key != nil && val != nil {
+				_ = msg.TryPutMapField(fd, key, val)
+			}
+			continue
+		}
+
+		val := exampleValue(fd, depth)
+		if val == nil {
+			continue
+		}
+
+		if fd.IsRepeated() {
+			_ = msg.TryAddRepeatedField(fd, val)
+		} else {
+			_ = msg.TrySetField(fd, val)
+		}
+	}
+
+	return msg
+}
+
+func exampleValue(fd *desc.FieldDescriptor, depth int) any {
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return true
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return float64(1.5)
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return float32(1.5)
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return fd.GetName()
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return []byte(fd.GetName())
+	case descriptor.FieldDescriptorProto_TYPE_INT32,
+		descriptor.FieldDescriptorProto_TYPE_SINT32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(1)
+	case descriptor.FieldDescriptorProto_TYPE_INT64,
+		descriptor.FieldDescriptorProto_TYPE_SINT64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64(1)
+	case descriptor.FieldDescriptorProto_TYPE_UINT32,
+		descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(1)
+	case descriptor.FieldDescriptorProto_TYPE_UINT64,
+		descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		return uint64(1)
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		values := fd.GetEnumType().GetValues()
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0].GetNumber()
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptor.FieldDescriptorProto_TYPE_GROUP:
+		return exampleMessage(fd.GetMessageType(), depth+1)
+	}
+
+	return nil
+}
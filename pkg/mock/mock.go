@@ -0,0 +1,343 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// MethodRule 方法的模拟规则
+type MethodRule struct {
+	Response  json.RawMessage   `json:"response,omitempty"`  // 固定回复, 为空时根据描述生成示例数据
+	Responses []json.RawMessage `json:"responses,omitempty"` // server stream 依次发送的回复
+	Error     *JsonError        `json:"error,omitempty"`     // 返回错误
+	DelayMs   int               `json:"delay_ms,omitempty"`  // 回复前延迟
+	Header    map[string]string `json:"header,omitempty"`
+	Trailer   map[string]string `json:"trailer,omitempty"`
+}
+
+type JsonError struct {
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message"`
+}
+
+// Server 根据反射得到的描述生成的模拟gRPC服务
+type Server struct {
+	files []*desc.FileDescriptor
+
+	rules    map[string]*MethodRule // key: package.Service/Method
+	rulesMux sync.RWMutex
+
+	srv *grpc.Server
+	lis *net.TCPListener
+}
+
+func NewServer(files []*desc.FileDescriptor, opts ...grpc.ServerOption) (*Server, error) {
+	registry, err := protodesc.NewFiles(desc.ToFileDescriptorSet(files...))
+	if err != nil {
+		return nil, err
+	}
+
+	tis := &Server{
+		files: files,
+		rules: map[string]*MethodRule{},
+		srv:   grpc.NewServer(opts...),
+	}
+
+	for _, sd := range tis.GetServiceDescriptors() {
+		tis.srv.RegisterService(tis.serviceDesc(sd), nil)
+	}
+
+	grpc_reflection_v1alpha.RegisterServerReflectionServer(tis.srv, reflection.NewServer(reflection.ServerOptions{
+		Services:           tis.srv,
+		DescriptorResolver: registry,
+	}))
+
+	return tis, nil
+}
+
+// LoadProtoset 读取protoc --descriptor_set_out生成的文件
+func LoadProtoset(filename string) ([]*desc.FileDescriptor, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseProtoset(data)
+}
+
+// ParseProtoset 解析protoset文件的内容
+func ParseProtoset(data []byte) ([]*desc.FileDescriptor, error) {
+	var fds dpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fds); err != nil {
+		return nil, err
+	}
+
+	files, err := desc.CreateFileDescriptorsFromSet(&fds)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*desc.FileDescriptor
+	for _, fd := range files {
+		result = append(result, fd)
+	}
+
+	return result, nil
+}
+
+// Start 监听127.0.0.1的端口, port为0时随机分配
+func (tis *Server) Start(port int) (int, error) {
+	lis, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		return 0, err
+	}
+
+	tis.lis = lis
+
+	go func() {
+		if err := tis.srv.Serve(lis); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return tis.Port(), nil
+}
+
+func (tis *Server) Port() int {
+	if tis.lis == nil {
+		return 0
+	}
+
+	return tis.lis.Addr().(*net.TCPAddr).Port
+}
+
+func (tis *Server) Close() {
+	tis.srv.Stop()
+}
+
+// GetServiceDescriptors 模拟的全部服务
+func (tis *Server) GetServiceDescriptors() []*desc.ServiceDescriptor {
+	var result []*desc.ServiceDescriptor
+	seen := map[string]bool{}
+	for _, fd := range tis.files {
+		for _, sd := range fd.GetServices() {
+			if seen[sd.GetFullyQualifiedName()] {
+				continue
+			}
+
+			seen[sd.GetFullyQualifiedName()] = true
+			result = append(result, sd)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetFullyQualifiedName() < result[j].GetFullyQualifiedName()
+	})
+
+	return result
+}
+
+// SetRule 设置方法的模拟规则, rule为nil时删除
+func (tis *Server) SetRule(service, method string, rule *MethodRule) {
+	tis.rulesMux.Lock()
+	defer tis.rulesMux.Unlock()
+
+	key := fmt.Sprintf("%v/%v", service, method)
+	if rule == nil {
+		delete(tis.rules, key)
+	} else {
+		tis.rules[key] = rule
+	}
+}
+
+func (tis *Server) GetRules() map[string]*MethodRule {
+	tis.rulesMux.RLock()
+	defer tis.rulesMux.RUnlock()
+
+	result := map[string]*MethodRule{}
+	for k, v := range tis.rules {
+		result[k] = v
+	}
+
+	return result
+}
+
+func (tis *Server) getRule(mtd *desc.MethodDescriptor) *MethodRule {
+	tis.rulesMux.RLock()
+	defer tis.rulesMux.RUnlock()
+
+	key := fmt.Sprintf("%v/%v", mtd.GetService().GetFullyQualifiedName(), mtd.GetName())
+	if rule, ok := tis.rules[key]; ok {
+		return rule
+	}
+
+	return &MethodRule{}
+}
+
+func (tis *Server) serviceDesc(sd *desc.ServiceDescriptor) *grpc.ServiceDesc {
+	result := &grpc.ServiceDesc{
+		ServiceName: sd.GetFullyQualifiedName(),
+		HandlerType: (*any)(nil),
+		Metadata:    sd.GetFile().GetName(),
+	}
+
+	for _, md := range sd.GetMethods() {
+		mtd := md
+		if !mtd.IsClientStreaming() && !mtd.IsServerStreaming() {
+			result.Methods = append(result.Methods, grpc.MethodDesc{
+				MethodName: mtd.GetName(),
+				Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+					req := dynamic.NewMessage(mtd.GetInputType())
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+
+					if interceptor == nil {
+						return tis.handleUnary(ctx, mtd, req)
+					}
+
+					info := &grpc.UnaryServerInfo{
+						Server:     srv,
+						FullMethod: fmt.Sprintf("/%v/%v", sd.GetFullyQualifiedName(), mtd.GetName()),
+					}
+					return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+						return tis.handleUnary(ctx, mtd, req.(*dynamic.Message))
+					})
+				},
+			})
+		} else {
+			result.Streams = append(result.Streams, grpc.StreamDesc{
+				StreamName:    mtd.GetName(),
+				ServerStreams: mtd.IsServerStreaming(),
+				ClientStreams: mtd.IsClientStreaming(),
+				Handler: func(srv any, stream grpc.ServerStream) error {
+					return tis.handleStream(stream, mtd)
+				},
+			})
+		}
+	}
+
+	return result
+}
+
+func (tis *Server) handleUnary(ctx context.Context, mtd *desc.MethodDescriptor, _ *dynamic.Message) (any, error) {
+	rule := tis.getRule(mtd)
+
+	if err := rule.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	if len(rule.Header) > 0 {
+		_ = grpc.SetHeader(ctx, metadata.New(rule.Header))
+	}
+	if len(rule.Trailer) > 0 {
+		_ = grpc.SetTrailer(ctx, metadata.New(rule.Trailer))
+	}
+
+	if rule.Error != nil {
+		return nil, status.Error(rule.Error.Code, rule.Error.Message)
+	}
+
+	return NewResponse(mtd.GetOutputType(), rule.Response)
+}
+
+func (tis *Server) handleStream(stream grpc.ServerStream, mtd *desc.MethodDescriptor) error {
+	rule := tis.getRule(mtd)
+
+	// 接收客户端的全部消息
+	if mtd.IsClientStreaming() {
+		for {
+			req := dynamic.NewMessage(mtd.GetInputType())
+			if err := stream.RecvMsg(req); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+	} else {
+		req := dynamic.NewMessage(mtd.GetInputType())
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+	}
+
+	if err := rule.wait(stream.Context()); err != nil {
+		return err
+	}
+
+	if len(rule.Header) > 0 {
+		_ = stream.SetHeader(metadata.New(rule.Header))
+	}
+	if len(rule.Trailer) > 0 {
+		stream.SetTrailer(metadata.New(rule.Trailer))
+	}
+
+	if rule.Error != nil {
+		return status.Error(rule.Error.Code, rule.Error.Message)
+	}
+
+	responses := rule.Responses
+	if !mtd.IsServerStreaming() || len(responses) == 0 {
+		responses = []json.RawMessage{rule.Response}
+	}
+
+	for _, raw := range responses {
+		resp, err := NewResponse(mtd.GetOutputType(), raw)
+		if err != nil {
+			return err
+		}
+
+		if err = stream.SendMsg(resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tis *MethodRule) wait(ctx context.Context) error {
+	if tis.DelayMs <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-time.After(time.Duration(tis.DelayMs) * time.Millisecond):
+		return nil
+	}
+}
+
+// NewResponse 根据json构建回复, json为空时生成示例数据
+func NewResponse(md *desc.MessageDescriptor, data json.RawMessage) (*dynamic.Message, error) {
+	if len(data) == 0 {
+		return ExampleMessage(md), nil
+	}
+
+	msg := dynamic.NewMessage(md)
+	if err := msg.UnmarshalJSON(data); err != nil {
+		return nil, status.Errorf(codes.Internal, "mock response of %v: %v", md.GetFullyQualifiedName(), err)
+	}
+
+	return msg, nil
+}
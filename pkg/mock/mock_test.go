@@ -0,0 +1,151 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/examples/helloworld"
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestServer(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor(helloworld.File_helloworld_helloworld_proto.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer([]*desc.FileDescriptor{fd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.SetRule("helloworld.Greeter", "SayHello", &MethodRule{
+		Response: json.RawMessage(`{"message": "mocked"}`),
+		Header:   map[string]string{"x-mock": "1"},
+	})
+	srv.SetRule("helloworld.Greeter", "GetVersion", &MethodRule{
+		Error: &JsonError{Code: codes.Unavailable, Message: "down"},
+	})
+
+	port, err := srv.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, fmt.Sprintf("127.0.0.1:%v", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := helloworld.NewGreeterClient(conn)
+
+	var header metadata.MD
+	reply, err := cli.SayHello(ctx, &helloworld.HelloRequest{Name: "a"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.GetMessage() != "mocked" || len(header.Get("x-mock")) == 0 {
+		t.Errorf("reply %v, header %v", reply, header)
+	}
+
+	if _, err = cli.GetVersion(ctx, &helloworld.GetVersionReq{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("want Unavailable, got %v", err)
+	}
+
+	// 删除规则后生成示例数据
+	srv.SetRule("helloworld.Greeter", "SayHello", nil)
+	if _, err = cli.SayHello(ctx, &helloworld.HelloRequest{Name: "a"}); err != nil {
+		t.Errorf("example reply: %v", err)
+	}
+	if rules := srv.GetRules(); len(rules) != 1 {
+		t.Errorf("rules %v", rules)
+	}
+}
+
+// TestServerDelay 延迟回复, 超过调用方的deadline时返回DeadlineExceeded
+func TestServerDelay(t *testing.T) {
+	cli, srv := startHello(t)
+	defer srv.Close()
+
+	srv.SetRule("helloworld.Greeter", "SayHello", &MethodRule{DelayMs: 200})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := cli.SayHello(ctx, &helloworld.HelloRequest{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*200 {
+		t.Errorf("replied after %v", elapsed)
+	}
+
+	short, cancelShort := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancelShort()
+	if _, err := cli.SayHello(short, &helloworld.HelloRequest{Name: "a"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestServerReflection 通过反射得到模拟的服务, 只监听127.0.0.1
+func TestServerReflection(t *testing.T) {
+	_, srv := startHello(t)
+	defer srv.Close()
+
+	if ip := srv.lis.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		t.Errorf("listen on %v", ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	cli := stub.NewStub("127.0.0.1", srv.Port())
+	if err := cli.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, ok := cli.GetServerInfo().GetMethod("helloworld.Greeter", "SayHello"); !ok {
+		t.Errorf("services %+v", cli.GetServerInfo().Services)
+	}
+}
+
+func startHello(t *testing.T) (helloworld.GreeterClient, *Server) {
+	fd, err := desc.LoadFileDescriptor(helloworld.File_helloworld_helloworld_proto.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer([]*desc.FileDescriptor{fd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := srv.Start(0)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%v", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return helloworld.NewGreeterClient(conn), srv
+}
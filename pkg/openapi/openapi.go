@@ -0,0 +1,198 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// InvokePath 与 /rpc/invoke/:ServiceName/:MethodName 一致
+const InvokePath = "/rpc/invoke/%v/%v"
+
+// Generate 为已注册的gRPC服务生成OpenAPI 3文档, 每个method对应一个POST接口, 同名服务只保留第一个
+func Generate(services []*stub.JsonService, serverURL string) *openapi3.T {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:   "grpc_invoke",
+			Version: "1.0.0",
+		},
+		Paths: openapi3.Paths{},
+		Components: openapi3.Components{
+			Schemas: openapi3.Schemas{},
+		},
+	}
+
+	if len(serverURL) > 0 {
+		doc.Servers = openapi3.Servers{{URL: serverURL}}
+	}
+
+	metadataSchema := openapi3.NewObjectSchema().WithAdditionalProperties(
+		openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()))
+	errorSchema := openapi3.NewObjectSchema().WithProperty("error", openapi3.NewStringSchema())
+	backendSchema := openapi3.NewStringSchema()
+	backendSchema.Description = "backend id, name or target, empty for the first backend with the method"
+	confirmTokenSchema := openapi3.NewStringSchema()
+	confirmTokenSchema.Description = "confirm token returned by 428, required for non-safe methods on read-only backends"
+	confirmSchema := openapi3.NewObjectSchema().
+		WithProperty("error", openapi3.NewStringSchema()).
+		WithProperty("confirm", openapi3.NewStringSchema())
+
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	seen := map[string]bool{}
+	for _, service := range services {
+		if seen[service.Name] {
+			continue
+		}
+		seen[service.Name] = true
+
+		doc.Tags = append(doc.Tags, &openapi3.Tag{Name: service.Name})
+
+		for _, method := range service.Methods {
+			request := openapi3.NewObjectSchema().
+				WithProperty("header", openapi3.NewObjectSchema().WithAdditionalProperties(openapi3.NewStringSchema()))
+			request.Properties["data"] = messageRef(method.GetMethodDescriptor().GetInputType(), doc.Components.Schemas)
+			request.Properties["backend"] = openapi3.NewSchemaRef("", backendSchema)
+			request.Properties["confirm"] = openapi3.NewSchemaRef("", confirmTokenSchema)
+
+			reply := openapi3.NewObjectSchema().
+				WithProperty("header", metadataSchema).
+				WithProperty("trailer", metadataSchema)
+			reply.Properties["data"] = messageRef(method.GetMethodDescriptor().GetOutputType(), doc.Components.Schemas)
+
+			operation := openapi3.NewOperation()
+			operation.OperationID = fmt.Sprintf("%v.%v", service.Name, method.Name)
+			operation.Summary = fmt.Sprintf("%v(%v) returns (%v)", method.Name, method.Request, method.Response)
+			operation.Tags = []string{service.Name}
+			operation.RequestBody = &openapi3.RequestBodyRef{
+				Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchema(request),
+			}
+			operation.Responses = openapi3.Responses{
+				"200": {Value: openapi3.NewResponse().WithDescription("OK").WithJSONSchema(reply)},
+				"400": {Value: openapi3.NewResponse().WithDescription("invalid request").WithJSONSchema(errorSchema)},
+				"403": {Value: openapi3.NewResponse().WithDescription("forbidden").WithJSONSchema(errorSchema)},
+				"404": {Value: openapi3.NewResponse().WithDescription("method not found").WithJSONSchema(errorSchema)},
+				"409": {Value: openapi3.NewResponse().WithDescription("backend name matches multiple backends").WithJSONSchema(errorSchema)},
+				"428": {Value: openapi3.NewResponse().WithDescription("read-only backend, resend with confirm").WithJSONSchema(confirmSchema)},
+				"500": {Value: openapi3.NewResponse().WithDescription("grpc error").WithJSONSchema(errorSchema)},
+			}
+
+			doc.Paths[fmt.Sprintf(InvokePath, service.Name, method.Name)] = &openapi3.PathItem{
+				Post: operation,
+			}
+		}
+	}
+
+	return doc
+}
+
+// messageRef 消息放入components按全名引用, 先放入再展开字段, 递归引用的消息直接引用
+func messageRef(msg *desc.MessageDescriptor, components openapi3.Schemas) *openapi3.SchemaRef {
+	if msg == nil {
+		return openapi3.NewSchemaRef("", openapi3.NewObjectSchema())
+	}
+
+	if result, ok := wellKnownSchema(msg, components); ok {
+		return openapi3.NewSchemaRef("", result)
+	}
+
+	name := msg.GetFullyQualifiedName()
+	if component, ok := components[name]; ok {
+		return openapi3.NewSchemaRef("#/components/schemas/"+name, component.Value)
+	}
+
+	result := openapi3.NewObjectSchema()
+	result.Title = msg.GetName()
+	components[name] = openapi3.NewSchemaRef("", result)
+
+	for _, field := range msg.GetFields() {
+		result.Properties[field.GetJSONName()] = fieldRef(field, components)
+	}
+
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, result)
+}
+
+// fieldRef 按proto3 json映射: map为object, 64位整数为字符串
+func fieldRef(field *desc.FieldDescriptor, components openapi3.Schemas) *openapi3.SchemaRef {
+	if field.IsMap() {
+		result := openapi3.NewObjectSchema()
+		result.AdditionalProperties = valueRef(field.GetMapValueType(), components)
+		return openapi3.NewSchemaRef("", result)
+	}
+
+	item := valueRef(field, components)
+	if field.IsRepeated() {
+		result := openapi3.NewArraySchema()
+		result.Items = item
+		return openapi3.NewSchemaRef("", result)
+	}
+
+	return item
+}
+
+func valueRef(field *desc.FieldDescriptor, components openapi3.Schemas) *openapi3.SchemaRef {
+	var result *openapi3.Schema
+
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return messageRef(field.GetMessageType(), components)
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		result = openapi3.NewStringSchema()
+		for _, value := range field.GetEnumType().GetValues() {
+			result.Enum = append(result.Enum, value.GetName())
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		result = openapi3.NewBoolSchema()
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+		descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		result = openapi3.NewFloat64Schema()
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		result = openapi3.NewStringSchema()
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		result = openapi3.NewBytesSchema()
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+		result = openapi3.NewStringSchema().WithFormat("int64")
+	default:
+		result = openapi3.NewInt32Schema()
+	}
+
+	return openapi3.NewSchemaRef("", result)
+}
+
+// wellKnownSchema google.protobuf.* 的json格式, 不展开字段
+func wellKnownSchema(msg *desc.MessageDescriptor, components openapi3.Schemas) (*openapi3.Schema, bool) {
+	switch msg.GetFullyQualifiedName() {
+	case "google.protobuf.Timestamp":
+		return openapi3.NewDateTimeSchema(), true
+	case "google.protobuf.Duration", "google.protobuf.FieldMask":
+		return openapi3.NewStringSchema(), true
+	case "google.protobuf.Struct", "google.protobuf.Any":
+		return openapi3.NewObjectSchema().WithAnyAdditionalProperties(), true
+	case "google.protobuf.Value":
+		return openapi3.NewSchema(), true
+	case "google.protobuf.ListValue":
+		return openapi3.NewArraySchema().WithItems(openapi3.NewSchema()), true
+	case "google.protobuf.Empty":
+		return openapi3.NewObjectSchema(), true
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		// 包装类型与value字段相同
+		return valueRef(msg.FindFieldByName("value"), components).Value, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,103 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/mock"
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TestGenerate 递归消息, map及google.protobuf.*字段
+func TestGenerate(t *testing.T) {
+	timestamp, err := desc.LoadMessageDescriptorForMessage(&timestamppb.Timestamp{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := desc.LoadMessageDescriptorForMessage(&structpb.Struct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := builder.NewMessage("Node")
+	node.AddField(builder.NewField("id", builder.FieldTypeInt64())).
+		AddField(builder.NewField("created_at", builder.FieldTypeImportedMessage(timestamp))).
+		AddField(builder.NewField("extra", builder.FieldTypeImportedMessage(object))).
+		AddField(builder.NewField("children", builder.FieldTypeMessage(node)).SetRepeated()).
+		AddField(builder.NewMapField("named", builder.FieldTypeString(), builder.FieldTypeMessage(node)))
+	sd := builder.NewService("Tree").
+		AddMethod(builder.NewMethod("Get", builder.RpcTypeMessage(node, false), builder.RpcTypeMessage(node, false)))
+
+	file, err := builder.NewFile("tree.proto").SetPackageName("test").SetProto3(true).
+		AddMessage(node).AddService(sd).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := mock.NewServer([]*desc.FileDescriptor{file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	port, err := srv.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	cli := stub.NewStub("127.0.0.1", port)
+	if err = cli.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 同名服务只生成一次
+	services := cli.GetServerInfo().Services
+	doc := Generate(append(services, services...), "http://127.0.0.1")
+	if err = doc.Validate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	operation := doc.Paths["/rpc/invoke/test.Tree/Get"].Post
+	data := operation.RequestBody.Value.Content.Get("application/json").Schema.Value.Properties["data"]
+	if data.Ref != "#/components/schemas/test.Node" {
+		t.Fatalf("data ref %v", data.Ref)
+	}
+
+	properties := doc.Components.Schemas["test.Node"].Value.Properties
+	if properties["id"].Value.Type != "string" || properties["createdAt"].Value.Format != "date-time" ||
+		properties["extra"].Value.Type != "object" {
+		t.Errorf("scalar fields %+v", properties)
+	}
+	if properties["children"].Value.Items.Ref != "#/components/schemas/test.Node" {
+		t.Errorf("children %+v", properties["children"].Value)
+	}
+	if named := properties["named"].Value; named.Type != "object" || named.AdditionalProperties.Ref != "#/components/schemas/test.Node" {
+		t.Errorf("named %+v", named)
+	}
+
+	if len(doc.Tags) != 1 {
+		t.Errorf("tags %v", len(doc.Tags))
+	}
+
+	request := operation.RequestBody.Value.Content.Get("application/json").Schema.Value
+	if request.Properties["backend"] == nil || request.Properties["confirm"] == nil {
+		t.Errorf("request %+v", request.Properties)
+	}
+	for _, code := range []string{"403", "409", "428"} {
+		if operation.Responses[code] == nil {
+			t.Errorf("response %v missing", code)
+		}
+	}
+}
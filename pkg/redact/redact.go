@@ -0,0 +1,272 @@
+package redact
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Mask 替换隐藏的值
+const Mask = "***"
+
+// debugRedactField google.protobuf.FieldOptions.debug_redact
+const debugRedactField = 16
+
+// DefaultHeaders 默认隐藏的header
+var DefaultHeaders = []string{"authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key"}
+
+// DefaultFields 默认隐藏的字段名
+var DefaultFields = []string{"*password*", "*passwd*", "*token*", "*secret*"}
+
+// Resolver 查找方法描述, 用于按字段选项 debug_redact 隐藏
+type Resolver func(service, method string) (*desc.MethodDescriptor, bool)
+
+// Redactor 按header名, 字段名和字段选项 debug_redact 隐藏敏感内容, 名称不区分大小写
+type Redactor struct {
+	headers map[string]bool
+	fields  []*regexp.Regexp
+	resolve Resolver
+}
+
+// New 在默认规则之外增加headers和fields, fields支持通配符*
+func New(headers []string, fields []string) *Redactor {
+	tis := &Redactor{
+		headers: map[string]bool{},
+	}
+
+	for _, name := range append(append([]string{}, DefaultHeaders...), headers...) {
+		tis.headers[strings.ToLower(name)] = true
+	}
+
+	for _, pattern := range append(append([]string{}, DefaultFields...), fields...) {
+		parts := strings.Split(strings.ToLower(pattern), "*")
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		tis.fields = append(tis.fields, regexp.MustCompile("^"+strings.Join(parts, ".*")+"$"))
+	}
+
+	return tis
+}
+
+// WithResolver 返回使用resolve查找方法描述的副本
+func (tis *Redactor) WithResolver(resolve Resolver) *Redactor {
+	r := *tis
+	r.resolve = resolve
+	return &r
+}
+
+// IsHeader header是否需要隐藏
+func (tis *Redactor) IsHeader(name string) bool {
+	return tis.headers[strings.ToLower(name)]
+}
+
+// IsField 字段名是否需要隐藏
+func (tis *Redactor) IsField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range tis.fields {
+		if field.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Header 返回隐藏后的副本
+func (tis *Redactor) Header(header map[string][]string) map[string][]string {
+	if header == nil {
+		return nil
+	}
+
+	result := make(map[string][]string, len(header))
+	for k, values := range header {
+		if tis.IsHeader(k) {
+			result[k] = []string{Mask}
+		} else {
+			result[k] = append([]string{}, values...)
+		}
+	}
+
+	return result
+}
+
+// Query 隐藏url中匹配字段名的查询参数
+func (tis *Redactor) Query(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return uri
+	}
+
+	changed := false
+	for k := range values {
+		if tis.IsField(k) {
+			values[k] = []string{Mask}
+			changed = true
+		}
+	}
+	if !changed {
+		return uri
+	}
+
+	return path + "?" + values.Encode()
+}
+
+// JSON 隐藏json中匹配的字段, 不是json时原样返回
+func (tis *Redactor) JSON(data []byte) []byte {
+	return tis.message(nil, data)
+}
+
+// Request 隐藏grpc请求json, 找到方法描述时同时按 debug_redact 隐藏
+func (tis *Redactor) Request(service, method string, data []byte) []byte {
+	if mtd, ok := tis.method(service, method); ok {
+		return tis.message(mtd.GetInputType(), data)
+	}
+
+	return tis.message(nil, data)
+}
+
+// Response 隐藏grpc回复json
+func (tis *Redactor) Response(service, method string, data []byte) []byte {
+	if mtd, ok := tis.method(service, method); ok {
+		return tis.message(mtd.GetOutputType(), data)
+	}
+
+	return tis.message(nil, data)
+}
+
+func (tis *Redactor) method(service, method string) (*desc.MethodDescriptor, bool) {
+	if tis.resolve == nil || len(service) == 0 || len(method) == 0 {
+		return nil, false
+	}
+
+	return tis.resolve(service, method)
+}
+
+func (tis *Redactor) message(md *desc.MessageDescriptor, data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+
+	var object any
+	if err := json.Unmarshal(data, &object); err != nil {
+		return data
+	}
+
+	result, err := json.Marshal(tis.walk(md, object))
+	if err != nil {
+		return data
+	}
+
+	return result
+}
+
+// walk md不为空时按字段描述查找 debug_redact 和嵌套的消息类型
+func (tis *Redactor) walk(md *desc.MessageDescriptor, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			fd := findField(md, k)
+			if tis.IsField(k) || DebugRedact(fd) {
+				result[k] = Mask
+				continue
+			}
+
+			result[k] = tis.walkField(fd, item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = tis.walk(md, item)
+		}
+		return result
+	}
+
+	return value
+}
+
+func (tis *Redactor) walkField(fd *desc.FieldDescriptor, value any) any {
+	if fd == nil {
+		return tis.walk(nil, value)
+	}
+
+	if fd.IsMap() {
+		// map的key不是字段名, 只检查value
+		m, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+
+		valueType := fd.GetMapValueType().GetMessageType()
+		result := make(map[string]any, len(m))
+		for k, item := range m {
+			if valueType != nil {
+				result[k] = tis.walk(valueType, item)
+			} else {
+				result[k] = item
+			}
+		}
+		return result
+	}
+
+	if md := fd.GetMessageType(); md != nil {
+		return tis.walk(md, value)
+	}
+
+	return value
+}
+
+func findField(md *desc.MessageDescriptor, name string) *desc.FieldDescriptor {
+	if md == nil {
+		return nil
+	}
+
+	for _, fd := range md.GetFields() {
+		if fd.GetJSONName() == name || fd.GetName() == name {
+			return fd
+		}
+	}
+
+	return nil
+}
+
+// DebugRedact 字段是否设置了 [debug_redact = true]
+func DebugRedact(fd *desc.FieldDescriptor) bool {
+	if fd == nil || fd.GetFieldOptions() == nil {
+		return false
+	}
+
+	// 当前版本的descriptorpb没有debug_redact, 从未知字段中读取
+	b := fd.GetFieldOptions().ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+
+		if num == debugRedactField && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			return n > 0 && v != 0
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+
+	return false
+}
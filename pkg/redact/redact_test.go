@@ -0,0 +1,58 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestRedactor(t *testing.T) {
+	opts := &descriptorpb.FieldOptions{}
+	opts.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, debugRedactField, protowire.VarintType), 1))
+
+	card := builder.NewMessage("Card").
+		AddField(builder.NewField("number", builder.FieldTypeString()).SetOptions(opts)).
+		AddField(builder.NewField("holder", builder.FieldTypeString()))
+	request := builder.NewMessage("PayRequest").
+		AddField(builder.NewField("user_name", builder.FieldTypeString())).
+		AddField(builder.NewField("card", builder.FieldTypeMessage(card))).
+		AddField(builder.NewMapField("cards", builder.FieldTypeString(), builder.FieldTypeMessage(card)))
+	sd := builder.NewService("Pay").
+		AddMethod(builder.NewMethod("Pay", builder.RpcTypeMessage(request, false), builder.RpcTypeMessage(card, false)))
+
+	file, err := builder.NewFile("pay.proto").SetPackageName("test").SetProto3(true).
+		AddMessage(card).AddMessage(request).AddService(sd).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtd := file.FindService("test.Pay").FindMethodByName("Pay")
+
+	r := New([]string{"X-Session"}, []string{"user_*"}).WithResolver(func(service, method string) (*desc.MethodDescriptor, bool) {
+		return mtd, service == "test.Pay" && method == "Pay"
+	})
+
+	got := string(r.Request("test.Pay", "Pay", []byte(`{"userName":"bob","card":{"number":"4111","holder":"bob"},"cards":{"a":{"number":"5500"}},"accessToken":"t"}`)))
+	want := `{"accessToken":"***","card":{"holder":"bob","number":"***"},"cards":{"a":{"number":"***"}},"userName":"bob"}`
+	if got != want {
+		t.Errorf("request\n got %v\nwant %v", got, want)
+	}
+
+	// 字段名按proto名称匹配
+	got = string(r.JSON([]byte(`{"user_name":"bob","list":[{"password":"p"}]}`)))
+	want = `{"list":[{"password":"***"}],"user_name":"***"}`
+	if got != want {
+		t.Errorf("json\n got %v\nwant %v", got, want)
+	}
+
+	header := r.Header(map[string][]string{"authorization": {"Bearer x"}, "x-session": {"s"}, "x-id": {"1"}})
+	if header["authorization"][0] != Mask || header["x-session"][0] != Mask || header["x-id"][0] != "1" {
+		t.Errorf("header %v", header)
+	}
+
+	if got := r.Query("/rpc/history?token=abc&kind=grpc"); got != "/rpc/history?kind=grpc&token=%2A%2A%2A" {
+		t.Errorf("query %v", got)
+	}
+}
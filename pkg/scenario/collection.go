@@ -0,0 +1,120 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Collection 保存的请求及其断言
+type Collection struct {
+	Name     string  `json:"name"`
+	Requests []*Step `json:"requests"`
+
+	filename string
+	mux      sync.Mutex
+}
+
+// LoadCollection 读取文件, 文件不存在时为空
+func LoadCollection(filename string) (*Collection, error) {
+	tis := &Collection{
+		filename: filename,
+		Requests: []*Step{},
+	}
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return tis, nil
+	} else if err != nil {
+		return tis, err
+	}
+
+	if err = json.Unmarshal(data, tis); err != nil {
+		return tis, fmt.Errorf("%v: %v", filename, err)
+	}
+
+	return tis, nil
+}
+
+func (tis *Collection) storage() error {
+	data, err := json.MarshalIndent(tis, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(tis.filename, data, 0644)
+}
+
+func (tis *Collection) List() []*Step {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	return append([]*Step(nil), tis.Requests...)
+}
+
+// Put 按名称添加或替换
+func (tis *Collection) Put(step *Step) error {
+	if len(step.Name) == 0 {
+		return fmt.Errorf("name is empty")
+	}
+
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	for i, item := range tis.Requests {
+		if item.Name == step.Name {
+			tis.Requests[i] = step
+			return tis.storage()
+		}
+	}
+
+	tis.Requests = append(tis.Requests, step)
+	return tis.storage()
+}
+
+func (tis *Collection) Delete(name string) (bool, error) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	for i, item := range tis.Requests {
+		if item.Name == name {
+			tis.Requests = append(tis.Requests[:i], tis.Requests[i+1:]...)
+			return true, tis.storage()
+		}
+	}
+
+	return false, nil
+}
+
+// Scenario 转为独立执行的场景, names为空时包含全部请求
+func (tis *Collection) Scenario(names ...string) *Scenario {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	result := &Scenario{
+		Name:              tis.Name,
+		ContinueOnFailure: true,
+	}
+	if len(result.Name) == 0 {
+		result.Name = "requests"
+	}
+
+	for _, step := range tis.Requests {
+		if len(names) == 0 || contains(names, step.Name) {
+			result.Steps = append(result.Steps, step)
+		}
+	}
+
+	return result
+}
+
+func contains(items []string, v string) bool {
+	for _, item := range items {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
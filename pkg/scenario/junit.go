@@ -0,0 +1,80 @@
+package scenario
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(ms float64) string {
+	return fmt.Sprintf("%.3f", ms/1000)
+}
+
+// JUnit 生成JUnit格式的报告, 可供CI展示
+func JUnit(reports ...*Report) ([]byte, error) {
+	var suites junitTestSuites
+	for _, report := range reports {
+		suite := junitTestSuite{
+			Name: report.Name,
+			Time: seconds(report.DurationMs),
+		}
+
+		for _, step := range report.Steps {
+			item := junitTestCase{
+				Name:      step.Name,
+				ClassName: fmt.Sprintf("%v.%v", step.Service, step.Method),
+				Time:      seconds(step.DurationMs),
+			}
+
+			if step.Skipped {
+				item.Skipped = &struct{}{}
+				suite.Skipped++
+			} else if len(step.Failures) > 0 {
+				item.Failure = &junitFailure{
+					Message: step.Failures[0],
+					Text:    strings.Join(step.Failures, "\n"),
+				}
+				suite.Failures++
+			}
+
+			suite.Tests++
+			suite.Cases = append(suite.Cases, item)
+		}
+
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(&suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
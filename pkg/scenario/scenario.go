@@ -0,0 +1,379 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/jsonpath"
+	"github.com/general252/grpc_invoke/pkg/schema"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario 依次执行的一组调用
+//
+//	name: user crud
+//	steps:
+//	  - name: create
+//	    service: user.UserService
+//	    method: Create
+//	    data: {"name": "tom"}
+//	    extract: {id: $.user.id}
+//	  - name: get
+//	    service: user.UserService
+//	    method: Get
+//	    data: {"id": "${id}"}
+//	    assert:
+//	      - status: OK
+//	      - path: $.user.name
+//	        equals: tom
+type Scenario struct {
+	Name   string            `json:"name"`
+	Target string            `json:"target,omitempty"` // 后端id, 名称或target(host:port), 为空时由调用方决定
+	Vars   map[string]string `json:"vars,omitempty"`
+	Steps  []*Step           `json:"steps"`
+
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"` // 失败后继续执行后续步骤, 用于一组独立的请求
+}
+
+type Step struct {
+	Name    string            `json:"name"`
+	Service string            `json:"service"`
+	Method  string            `json:"method"`
+	Header  map[string]string `json:"header,omitempty"`
+	Data    json.RawMessage   `json:"data,omitempty"`
+	Extract map[string]string `json:"extract,omitempty"` // 变量名 -> jsonpath
+	Assert  []*Assertion      `json:"assert,omitempty"`
+}
+
+// Assertion 断言, 每条只设置一项
+type Assertion struct {
+	Status    string  `json:"status,omitempty"`     // grpc code, 如 OK, NotFound 或 5
+	Path      string  `json:"path,omitempty"`       // jsonpath
+	Equals    any     `json:"equals,omitempty"`     // 与path的值相等
+	Matches   string  `json:"matches,omitempty"`    // path的值匹配正则
+	Exists    *bool   `json:"exists,omitempty"`     // path是否存在
+	LatencyMs float64 `json:"latency_ms,omitempty"` // 耗时小于
+	Schema    bool    `json:"schema,omitempty"`     // 回复符合method的output schema
+}
+
+// Invoker 执行一次grpc调用, 与 stub.Stub.InvokeRPC 一致
+type Invoker func(ctx context.Context, service, method string, requestJsonData string, head map[string]string) (res string, header, trailer metadata.MD, err error)
+
+// SchemaFunc 获取method回复的schema, 用于schema断言
+type SchemaFunc func(service, method string) (*schema.JsonSchema, bool)
+
+// Parse 解析json或yaml
+func Parse(data []byte) (*Scenario, error) {
+	var result Scenario
+	if err := json.Unmarshal(data, &result); err == nil {
+		return &result, nil
+	}
+
+	var object any
+	if err := yaml.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	// yaml 转为 json 后解析, 保持 json tag 与 json.RawMessage 的行为
+	jsonData, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(jsonData, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type StepResult struct {
+	Name       string          `json:"name"`
+	Service    string          `json:"service"`
+	Method     string          `json:"method"`
+	Status     string          `json:"status"`
+	DurationMs float64         `json:"duration_ms"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Failures   []string        `json:"failures,omitempty"`
+	Skipped    bool            `json:"skipped,omitempty"`
+}
+
+func (tis *StepResult) Passed() bool {
+	return !tis.Skipped && len(tis.Failures) == 0
+}
+
+type Report struct {
+	Name       string         `json:"name"`
+	Passed     bool           `json:"passed"`
+	DurationMs float64        `json:"duration_ms"`
+	Steps      []*StepResult  `json:"steps"`
+	Vars       map[string]any `json:"vars"`
+}
+
+// Run 依次执行, 某一步失败后后续步骤跳过, schemas可以为nil
+func Run(ctx context.Context, s *Scenario, invoke Invoker, schemas SchemaFunc) *Report {
+	start := time.Now()
+
+	report := &Report{
+		Name:   s.Name,
+		Passed: true,
+		Vars:   map[string]any{},
+	}
+	for k, v := range s.Vars {
+		report.Vars[k] = v
+	}
+
+	for i, step := range s.Steps {
+		result := &StepResult{
+			Name:    step.Name,
+			Service: step.Service,
+			Method:  step.Method,
+		}
+		if len(result.Name) == 0 {
+			result.Name = fmt.Sprintf("%v.%v", i+1, step.Method)
+		}
+		report.Steps = append(report.Steps, result)
+
+		if !report.Passed && !s.ContinueOnFailure {
+			result.Skipped = true
+			continue
+		}
+
+		runStep(ctx, step, invoke, schemas, report.Vars, result)
+		if !result.Passed() {
+			report.Passed = false
+		}
+	}
+
+	report.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+
+	return report
+}
+
+func runStep(ctx context.Context, step *Step, invoke Invoker, schemas SchemaFunc, vars map[string]any, result *StepResult) {
+	data := "{}"
+	if len(step.Data) > 0 {
+		expanded, err := ExpandJSON(step.Data, vars)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("invalid data: %v", err))
+			return
+		}
+		data = expanded
+	}
+
+	header := map[string]string{}
+	for k, v := range step.Header {
+		header[k] = Expand(v, vars)
+	}
+
+	start := time.Now()
+	resp, _, _, err := invoke(ctx, step.Service, step.Method, data, header)
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	result.Status = status.Code(err).String()
+
+	var object any
+	if err != nil {
+		result.Error = status.Convert(err).Message()
+	} else {
+		result.Response = json.RawMessage(resp)
+		if err = json.Unmarshal([]byte(resp), &object); err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("invalid response: %v", err))
+			return
+		}
+	}
+
+	assertions := step.Assert
+	if len(assertions) == 0 {
+		assertions = []*Assertion{{Status: "OK"}}
+	}
+
+	var outSchema *schema.JsonSchema
+	if schemas != nil {
+		outSchema, _ = schemas(step.Service, step.Method)
+	}
+
+	for _, assertion := range assertions {
+		if msg := assertion.Check(result, object, outSchema); len(msg) > 0 {
+			result.Failures = append(result.Failures, msg)
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	for name, path := range step.Extract {
+		v, err := jsonpath.Get(object, path)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("extract %v: %v", name, err))
+			continue
+		}
+		vars[name] = v
+	}
+}
+
+// Check 检查断言, 通过返回空字符串
+func (tis *Assertion) Check(result *StepResult, object any, outSchema *schema.JsonSchema) string {
+	if len(tis.Status) > 0 {
+		if !sameStatus(tis.Status, result.Status) {
+			return fmt.Sprintf("status: want %v, got %v", tis.Status, result.Status)
+		}
+	}
+
+	if tis.LatencyMs > 0 && result.DurationMs > tis.LatencyMs {
+		return fmt.Sprintf("latency: want < %vms, got %vms", tis.LatencyMs, result.DurationMs)
+	}
+
+	if tis.Schema {
+		if outSchema == nil {
+			return fmt.Sprintf("schema: not found [%v:%v]", result.Service, result.Method)
+		}
+		if errs := schema.Validate(outSchema, object); len(errs) > 0 {
+			return fmt.Sprintf("schema: %v", strings.Join(errs, "; "))
+		}
+	}
+
+	if len(tis.Path) > 0 {
+		v, err := jsonpath.Get(object, tis.Path)
+
+		if tis.Exists != nil {
+			if *tis.Exists != (err == nil) {
+				return fmt.Sprintf("%v: want exists %v", tis.Path, *tis.Exists)
+			}
+			return ""
+		}
+
+		if err != nil {
+			return err.Error()
+		}
+
+		if tis.Equals != nil && !jsonEqual(tis.Equals, v) {
+			return fmt.Sprintf("%v: want %v, got %v", tis.Path, toString(tis.Equals), toString(v))
+		}
+
+		if len(tis.Matches) > 0 {
+			re, err := regexp.Compile(tis.Matches)
+			if err != nil {
+				return fmt.Sprintf("%v: %v", tis.Path, err)
+			}
+			if !re.MatchString(toString(v)) {
+				return fmt.Sprintf("%v: %v not match %v", tis.Path, toString(v), tis.Matches)
+			}
+		}
+	}
+
+	return ""
+}
+
+func sameStatus(want, got string) bool {
+	if strings.EqualFold(want, got) {
+		return true
+	}
+
+	if n, err := strconv.Atoi(want); err == nil {
+		return codes.Code(n).String() == got
+	}
+
+	return false
+}
+
+// jsonEqual 按json值比较, yaml中的 1 与响应中的 "1" (int64) 视为相等
+func jsonEqual(a, b any) bool {
+	var normalize = func(v any) any {
+		data, _ := json.Marshal(v)
+		var result any
+		_ = json.Unmarshal(data, &result)
+		return result
+	}
+
+	na, nb := normalize(a), normalize(b)
+	if reflect.DeepEqual(na, nb) {
+		return true
+	}
+
+	return toString(na) == toString(nb)
+}
+
+func toString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	}
+
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)}`)
+
+// Expand 替换 ${name}, 未定义的变量保持原样
+func Expand(s string, vars map[string]any) string {
+	return varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := varPattern.FindStringSubmatch(match)[1]
+		v, ok := vars[name]
+		if !ok {
+			return match
+		}
+		return toString(v)
+	})
+}
+
+// ExpandJSON 解析后在字符串值中替换 ${name}, 变量中的引号等字符由json编码转义
+// 整个字符串只有一个变量且变量为对象或数组时替换为该值
+func ExpandJSON(data []byte, vars map[string]any) (string, error) {
+	// 保留数字原样, 避免大整数丢失精度
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object any
+	if err := decoder.Decode(&object); err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(expandValue(object, vars))
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+func expandValue(v any, vars map[string]any) any {
+	switch val := v.(type) {
+	case string:
+		if match := varPattern.FindStringSubmatch(val); match != nil && match[0] == val {
+			switch item := vars[match[1]].(type) {
+			case map[string]any, []any:
+				return item
+			}
+		}
+		return Expand(val, vars)
+	case map[string]any:
+		result := make(map[string]any, len(val))
+		for k, item := range val {
+			result[Expand(k, vars)] = expandValue(item, vars)
+		}
+		return result
+	case []any:
+		result := make([]any, len(val))
+		for i, item := range val {
+			result[i] = expandValue(item, vars)
+		}
+		return result
+	}
+
+	return v
+}
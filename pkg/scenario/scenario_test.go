@@ -0,0 +1,98 @@
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/examples"
+	"github.com/general252/grpc_invoke/pkg/stub"
+)
+
+func TestExpandJSON(t *testing.T) {
+	vars := map[string]any{
+		"name": `a"b\c`,
+		"id":   float64(7),
+		"user": map[string]any{"name": "tom"},
+	}
+
+	data, err := ExpandJSON([]byte(`{"name": "${name}", "title": "id-${id}", "user": "${user}", "other": "${other}"}`), vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var object map[string]any
+	if err = json.Unmarshal([]byte(data), &object); err != nil {
+		t.Fatalf("invalid json %v: %v", data, err)
+	}
+	if object["name"] != `a"b\c` || object["title"] != "id-7" || object["other"] != "${other}" {
+		t.Errorf("expand %v", data)
+	}
+	if user, ok := object["user"].(map[string]any); !ok || user["name"] != "tom" {
+		t.Errorf("expand object %v", data)
+	}
+}
+
+// TestRun 提取上一步回复中的字段, 作为下一步的请求
+func TestRun(t *testing.T) {
+	port, err := examples.RunHelloServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	cli := stub.NewStub("127.0.0.1", port)
+	if err = cli.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	s, err := Parse([]byte(`
+name: hello
+vars: {name: 'tom "jr"'}
+steps:
+  - name: first
+    service: helloworld.Greeter
+    method: SayHello
+    data: {"name": "${name}"}
+    extract: {message: $.message}
+  - name: second
+    service: helloworld.Greeter
+    method: SayHello
+    data: {"name": "${message}"}
+    assert:
+      - status: OK
+      - path: $.message
+        equals: hello hello tom "jr"
+  - name: failed
+    service: helloworld.Greeter
+    method: SayHello
+    assert:
+      - status: NotFound
+  - name: skipped
+    service: helloworld.Greeter
+    method: SayHello
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Run(ctx, s, cli.InvokeRPC, nil)
+	if report.Passed || len(report.Steps) != 4 {
+		t.Fatalf("report %+v", report)
+	}
+	for i, step := range report.Steps[:2] {
+		if !step.Passed() {
+			t.Errorf("step %v: %v %v %v", i, step.Status, step.Error, step.Failures)
+		}
+	}
+	if report.Steps[2].Passed() || !report.Steps[3].Skipped {
+		t.Errorf("steps %+v %+v", report.Steps[2], report.Steps[3])
+	}
+	if report.Vars["message"] != `hello tom "jr"` {
+		t.Errorf("vars %v", report.Vars)
+	}
+}
@@ -25,6 +25,8 @@ type JsonSchema struct {
 	Options map[string]any `json:"options"`
 
 	Properties map[string]*JsonSchema `json:"properties,omitempty"`
+
+	AdditionalProperties *JsonSchema `json:"additionalProperties,omitempty"` // map的值
 }
 
 // JsonSchemaType https://json-schema.apifox.cn/#%E6%95%B0%E6%8D%AE%E7%B1%BB%E5%9E%8B
@@ -0,0 +1,133 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Validate 校验json.Unmarshal得到的数据, 返回全部错误
+// 按proto3 json映射: int64等可以是字符串, google.protobuf.* 的消息可以是任意值,
+// map的值按additionalProperties校验, Properties为nil的object(递归引用的消息)不检查字段
+func Validate(s *JsonSchema, v any) []string {
+	var errs []string
+	validate(s, v, "$", &errs)
+	return errs
+}
+
+func validate(s *JsonSchema, v any, path string, errs *[]string) {
+	if s == nil || v == nil {
+		return
+	}
+
+	var fail = func(format string, args ...any) {
+		*errs = append(*errs, fmt.Sprintf("%v: %v", path, fmt.Sprintf(format, args...)))
+	}
+
+	if strings.HasPrefix(s.Description, "google.protobuf.") {
+		return
+	}
+
+	switch s.Type {
+	case JsonSchemaTypeObject:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("want object, got %v", typeName(v))
+			return
+		}
+
+		if s.AdditionalProperties != nil {
+			for k, item := range obj {
+				validate(s.AdditionalProperties, item, path+"."+k, errs)
+			}
+			return
+		}
+		if s.Properties == nil {
+			return
+		}
+
+		for k, item := range obj {
+			prop, ok := s.Properties[k]
+			if !ok {
+				fail("unknown field %v", k)
+				continue
+			}
+			validate(prop, item, path+"."+k, errs)
+		}
+	case JsonSchemaTypeArray:
+		arr, ok := v.([]any)
+		if !ok {
+			fail("want array, got %v", typeName(v))
+			return
+		}
+
+		for i, item := range arr {
+			validate(s.Items, item, fmt.Sprintf("%v[%v]", path, i), errs)
+		}
+	case JsonSchemaTypeString:
+		str, ok := v.(string)
+		if !ok {
+			fail("want string, got %v", typeName(v))
+			return
+		}
+
+		if len(s.Enum) > 0 {
+			for _, e := range s.Enum {
+				if e == str {
+					return
+				}
+			}
+			fail("%v not in %v", str, s.Enum)
+		}
+	case JsonSchemaTypeInteger:
+		switch val := v.(type) {
+		case float64:
+			if val != float64(int64(val)) {
+				fail("want integer, got %v", val)
+			}
+		case string:
+			if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+				if _, err = strconv.ParseUint(val, 10, 64); err != nil {
+					fail("want integer, got %q", val)
+				}
+			}
+		default:
+			fail("want integer, got %v", typeName(v))
+		}
+	case JsonSchemaTypeNumber:
+		switch val := v.(type) {
+		case float64:
+		case string:
+			// NaN, Infinity 或数字字符串
+			if _, err := strconv.ParseFloat(val, 64); err != nil && val != "NaN" && val != "Infinity" && val != "-Infinity" {
+				fail("want number, got %q", val)
+			}
+		default:
+			fail("want number, got %v", typeName(v))
+		}
+	case JsonSchemaTypeBoolean:
+		if _, ok := v.(bool); !ok {
+			fail("want boolean, got %v", typeName(v))
+		}
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,32 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	s := &JsonSchema{
+		Type: JsonSchemaTypeObject,
+		Properties: map[string]*JsonSchema{
+			"name":  {Type: JsonSchemaTypeString},
+			"id":    {Type: JsonSchemaTypeInteger},
+			"day":   {Type: JsonSchemaTypeString, Enum: []string{"Sunday", "Monday"}},
+			"ss":    {Type: JsonSchemaTypeArray, Items: &JsonSchema{Type: JsonSchemaTypeInteger}},
+			"when":  {Type: JsonSchemaTypeObject, Description: "google.protobuf.Timestamp"},
+			"valid": {Type: JsonSchemaTypeBoolean},
+		},
+	}
+
+	var ok any
+	_ = json.Unmarshal([]byte(`{"name": "a", "id": "9007199254740993", "day": "Monday", "ss": [1, 2], "when": "2022-01-01T00:00:00Z", "valid": true}`), &ok)
+	if errs := Validate(s, ok); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var bad any
+	_ = json.Unmarshal([]byte(`{"name": 1, "id": 1.5, "day": "Friday", "ss": ["x"], "other": 1}`), &bad)
+	if errs := Validate(s, bad); len(errs) != 5 {
+		t.Fatal(errs)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// auditedKey 接口已记录详细的审计日志, auditMiddleware不再记录
+const auditedKey = "audited"
+
+// newEvent 使用ctx中的用户和客户端地址
+func newEvent(ctx context.Context, action string) *audit.Event {
+	e := &audit.Event{
+		Action: action,
+		Remote: audit.RemoteFromContext(ctx),
+	}
+	if id, ok := auth.FromContext(ctx); ok {
+		e.User = id.Name
+		e.Role = id.Role
+	}
+
+	return e
+}
+
+// addEvent 记录接口的审计日志
+func (tis *HttpServer) addEvent(c *gin.Context, e *audit.Event) {
+	c.Set(auditedKey, true)
+	tis.audit.Add(e)
+}
+
+// auditMiddleware 记录修改类的接口及被拒绝的访问, 调用类接口自行记录详细内容
+func (tis *HttpServer) auditMiddleware(c *gin.Context) {
+	c.Request = c.Request.WithContext(audit.WithRemote(c.Request.Context(), c.ClientIP()))
+	c.Next()
+
+	if c.GetBool(auditedKey) {
+		return
+	}
+
+	code := c.Writer.Status()
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions:
+		return
+	case len(c.FullPath()) == 0:
+		return
+	}
+
+	path := c.FullPath()
+	if len(path) == 0 {
+		path = c.Request.URL.Path
+	}
+
+	e := newEvent(c.Request.Context(), audit.ActionApi)
+	e.Method = c.Request.Method + " " + path
+	e.Target = c.Request.URL.RequestURI()
+	e.Code = code
+	tis.audit.Add(e)
+}
+
+// routerAudit 查询审计日志
+func (tis *HttpServer) routerAudit(c *gin.Context) {
+	var q audit.Query
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = 100
+	}
+
+	events, err := tis.audit.Find(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/auth"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// invokerRoutes invoker角色可访问的非GET接口, 其他非GET接口需要admin
+var invokerRoutes = map[string]bool{
+	"POST /rpc/invoke/:ServiceName/:MethodName":     true,
+	"POST /rpc/bench/:ServiceName/:MethodName":      true,
+	"POST /rpc/compare/:ServiceName/:MethodName":    true,
+	"POST /rpc/scenario":                            true,
+	"POST /rpc/requests":                            true,
+	"DELETE /rpc/requests/:Name":                    true,
+	"POST /rpc/requests/run":                        true,
+	"POST /swagger/invoke/:ServiceName/:MethodName": true,
+}
+
+// publicRoutes 不需要登录
+var publicRoutes = map[string]bool{
+	"/":           true,
+	"/rpc/login":  true,
+	"/rpc/logout": true,
+}
+
+// adminRoutes 需要admin的GET接口
+var adminRoutes = map[string]bool{
+	"GET /rpc/audit": true,
+}
+
+// requiredRole 访问接口需要的角色
+func requiredRole(method, fullPath string) string {
+	switch {
+	case adminRoutes[method+" "+fullPath]:
+		return config.RoleAdmin
+	case strings.HasPrefix(fullPath, "/gw/"), strings.HasPrefix(fullPath, "/http/"):
+		// 调用时按服务和方法检查
+		return config.RoleInvoker
+	case invokerRoutes[method+" "+fullPath]:
+		return config.RoleInvoker
+	case method == http.MethodGet || method == http.MethodHead:
+		return config.RoleViewer
+	}
+
+	return config.RoleAdmin
+}
+
+// authMiddleware 启用认证时检查登录和角色, 用户保存在请求的context中
+func (tis *HttpServer) authMiddleware(c *gin.Context) {
+	if !tis.auth.Enabled() {
+		c.Next()
+		return
+	}
+
+	fullPath := c.FullPath()
+	if publicRoutes[fullPath] || strings.HasPrefix(fullPath, "/rpc/ui") {
+		c.Next()
+		return
+	}
+
+	id, ok := tis.auth.Authenticate(c.Request)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="grpc_invoke"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "unauthorized",
+		})
+		return
+	}
+
+	c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), id))
+
+	if required := requiredRole(c.Request.Method, fullPath); !auth.Allows(id.Role, required) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "requires role " + required,
+		})
+		return
+	}
+
+	c.Next()
+}
+
+type JsonLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type JsonLoginReply struct {
+	Token string `json:"token"` // 可作为 Authorization: Bearer <token>
+	*auth.Identity
+}
+
+func (tis *HttpServer) routerLogin(c *gin.Context) {
+	var request JsonLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	token, id, err := tis.auth.Login(request.Username, request.Password)
+
+	e := newEvent(c.Request.Context(), audit.ActionLogin)
+	e.User = request.Username
+	e.Code = http.StatusOK
+	if err != nil {
+		e.Code = http.StatusUnauthorized
+		e.Error = err.Error()
+	} else {
+		e.Role = id.Role
+	}
+	tis.addEvent(c, e)
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(auth.SessionCookie, token, int(auth.SessionTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, &JsonLoginReply{
+		Token:    token,
+		Identity: id,
+	})
+}
+
+func (tis *HttpServer) routerLogout(c *gin.Context) {
+	if cookie, err := c.Cookie(auth.SessionCookie); err == nil {
+		tis.auth.Logout(cookie)
+	}
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		tis.auth.Logout(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	c.SetCookie(auth.SessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// routerMe 当前用户, 未启用认证时为空
+func (tis *HttpServer) routerMe(c *gin.Context) {
+	id, _ := auth.FromContext(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  tis.auth.Enabled(),
+		"identity": id,
+	})
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	BackendPending      = "pending"      // 已添加, 正在连接和反射
+	BackendReady        = "ready"        // 反射成功
+	BackendError        = "error"        // 反射失败, 等待重试
+	BackendDisconnected = "disconnected" // 连接断开, 恢复后重新反射
+)
+
+const (
+	reflectTimeout = time.Second * 5
+	minBackoff     = time.Second
+	maxBackoff     = time.Minute
+)
+
+// backend 已添加的服务及其配置
+type backend struct {
+	*stub.Stub
+	id         string // 由target生成, 重启后不变
+	config     config.Service
+	fromConfig bool // 由配置文件添加, 配置文件中删除时一同删除
+
+	state       string
+	err         string
+	reflectTime time.Time
+	mux         sync.Mutex
+
+	done chan struct{}
+}
+
+func newBackend(service config.Service) (*backend, error) {
+	opts, callOpts := dialOptions(service)
+	cli := stub.NewStub(service.Host, service.Port, opts...)
+	if len(service.Target) > 0 {
+		cli = stub.NewTargetStub(service.Target, opts...)
+	}
+	cli.SetCallOptions(callOpts...)
+	if err := cli.Dial(); err != nil {
+		return nil, err
+	}
+
+	return &backend{
+		Stub:   cli,
+		id:     backendID(cli.Target()),
+		config: service,
+		state:  BackendPending,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func backendID(target string) string {
+	sum := sha1.Sum([]byte(target))
+	return hex.EncodeToString(sum[:4])
+}
+
+// match selector为id, 名称或target
+func (tis *backend) match(selector string) bool {
+	return selector == tis.id || selector == tis.Target() || (len(tis.config.Name) > 0 && selector == tis.config.Name)
+}
+
+var errBackendNotFound = errors.New("not found")
+
+var errBackendAmbiguous = errors.New("ambiguous")
+
+// selectBackend 查找有该方法的服务, selector为空时使用第一个, 名称重复时需要使用id或target
+// service为空时不检查方法
+func (tis *HttpServer) selectBackend(selector, service, method string) (*backend, error) {
+	var found []*backend
+	for _, cli := range tis.clients.list() {
+		if len(selector) > 0 && !cli.match(selector) {
+			continue
+		}
+		if len(service) == 0 {
+			found = append(found, cli)
+		} else if _, ok := cli.GetServerInfo().GetMethod(service, method); ok {
+			found = append(found, cli)
+		}
+	}
+
+	if len(found) == 0 {
+		if len(service) == 0 {
+			return nil, fmt.Errorf("%w backend %q", errBackendNotFound, selector)
+		}
+		if len(selector) > 0 {
+			return nil, fmt.Errorf("%w [%v:%v] on backend %q", errBackendNotFound, service, method, selector)
+		}
+		return nil, fmt.Errorf("%w [%v:%v]", errBackendNotFound, service, method)
+	}
+	if len(found) > 1 && len(selector) > 0 {
+		return nil, fmt.Errorf("%w backend %q matches %v backends, use id or target", errBackendAmbiguous, selector, len(found))
+	}
+
+	return found[0], nil
+}
+
+// abortSelect 未找到返回404, 名称重复返回409, 其他返回400
+func abortSelect(c *gin.Context, err error) {
+	code := http.StatusBadRequest
+	if errors.Is(err, errBackendNotFound) {
+		code = http.StatusNotFound
+	} else if errors.Is(err, errBackendAmbiguous) {
+		code = http.StatusConflict
+	}
+
+	c.JSON(code, gin.H{
+		"error": err.Error(),
+	})
+}
+
+func (tis *backend) setState(state string, err error) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	tis.state = state
+	tis.err = errorString(err)
+	if state == BackendReady {
+		tis.reflectTime = time.Now()
+	}
+}
+
+// close 停止后台反射并关闭连接
+func (tis *backend) close() {
+	close(tis.done)
+	tis.Stub.Close()
+}
+
+// runBackend 后台反射, 失败时退避重试, 连接断开恢复后重新反射, 直到删除服务
+func (tis *HttpServer) runBackend(b *backend) {
+	backoff := minBackoff
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), reflectTimeout)
+		err := b.Reflect(ctx)
+		cancel()
+
+		if err == nil {
+			registered := tis.clients.whileRegistered(b, func() {
+				b.setState(BackendReady, nil)
+				tis.gateway.Register(b.Stub)
+			})
+			if !registered {
+				return
+			}
+
+			backoff = minBackoff
+			if !waitReconnect(b) {
+				return
+			}
+			continue
+		}
+
+		log.Printf("reflect [%v] [%v] %v, retry in %v", b.config.Name, b.Target(), err, backoff)
+		b.setState(BackendError, err)
+
+		if !waitRetry(b, backoff) {
+			return
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// waitRetry 等待退避时间, 期间连接成功时立即重试, 返回false表示服务已删除
+func waitRetry(b *backend, backoff time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), backoff)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn := b.GetConn()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Shutdown:
+			return false
+		case connectivity.Ready:
+			// 连接已恢复但反射失败时仍按退避等待
+			<-ctx.Done()
+		case connectivity.Idle:
+			conn.Connect()
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			select {
+			case <-b.done:
+				return false
+			default:
+				return true
+			}
+		}
+		if conn.GetState() == connectivity.Ready {
+			return true
+		}
+	}
+}
+
+// waitReconnect 等待连接断开后恢复, 返回false表示服务已删除
+func waitReconnect(b *backend) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn := b.GetConn()
+	lost := false
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Shutdown:
+			return false
+		case connectivity.Ready:
+			if lost {
+				return true
+			}
+		case connectivity.Idle, connectivity.TransientFailure:
+			if !lost {
+				lost = true
+				b.setState(BackendDisconnected, nil)
+			}
+			// 断开后主动重连, 否则空闲的连接直到下次调用才会重连
+			conn.Connect()
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			return false
+		}
+	}
+}
+
+type JsonBackend struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Host        string     `json:"host,omitempty"`
+	Port        int        `json:"port,omitempty"`
+	Target      string     `json:"target"`
+	Balancer    string     `json:"balancer,omitempty"`
+	ReadOnly    bool       `json:"read_only,omitempty"`
+	FromConfig  bool       `json:"from_config,omitempty"` // 由配置文件添加
+	State       string     `json:"state"`                 // pending, ready, error, disconnected
+	Error       string     `json:"error,omitempty"`
+	ReflectTime *time.Time `json:"reflect_time,omitempty"` // 最近一次反射成功的时间
+	Services    []string   `json:"services"`
+}
+
+func (tis *backend) json() *JsonBackend {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	result := &JsonBackend{
+		ID:         tis.id,
+		Name:       tis.config.Name,
+		Host:       tis.Host(),
+		Port:       tis.Port(),
+		Target:     tis.Target(),
+		Balancer:   tis.config.Balancer,
+		ReadOnly:   tis.config.ReadOnly,
+		FromConfig: tis.fromConfig,
+		State:      tis.state,
+		Error:      tis.err,
+		Services:   []string{},
+	}
+	if !tis.reflectTime.IsZero() {
+		t := tis.reflectTime
+		result.ReflectTime = &t
+	}
+	for _, service := range tis.GetServerInfo().Services {
+		result.Services = append(result.Services, service.Name)
+	}
+
+	return result
+}
+
+func (tis *HttpServer) routerBackends(c *gin.Context) {
+	response := []*JsonBackend{}
+	for _, cli := range tis.clients.list() {
+		response = append(response, cli.json())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
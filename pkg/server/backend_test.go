@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/examples"
+	"github.com/general252/grpc_invoke/examples/helloworld"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// TestBackendReconnect 服务启动前添加, 启动后反射成功, 重启后重新反射
+func TestBackendReconnect(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := lis.Addr().(*net.TCPAddr).Port
+	_ = lis.Close()
+
+	srv := NewHttpServer()
+	defer srv.Close()
+
+	if err = srv.AddService(config.Service{Name: "hello", Host: "127.0.0.1", Port: port}); err != nil {
+		t.Fatal(err)
+	}
+	cli := srv.clients.list()[0]
+	if state := cli.json().State; state != BackendPending && state != BackendError {
+		t.Fatalf("state %v before the server listens", state)
+	}
+	waitState(t, cli, BackendError)
+
+	hello := serveHello(t, port)
+	waitState(t, cli, BackendReady)
+	first := cli.json().ReflectTime
+	if first == nil || len(cli.json().Services) == 0 {
+		t.Fatalf("backend %+v", cli.json())
+	}
+
+	hello.Stop()
+	waitState(t, cli, BackendDisconnected)
+
+	hello = serveHello(t, port)
+	defer hello.Stop()
+	waitState(t, cli, BackendReady)
+	if second := cli.json().ReflectTime; second == nil || !second.After(*first) {
+		t.Fatalf("not reflected again, %v %v", first, second)
+	}
+}
+
+// TestSelectBackend 按id, 名称, target选择后端, 名称重复及selector为空
+func TestSelectBackend(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := examples.RunHelloServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	defer srv.Close()
+
+	for _, service := range []config.Service{
+		{Name: "hello", Host: "127.0.0.1", Port: port},
+		{Name: "hello", Host: "localhost", Port: port},
+		{Name: "other", Target: fmt.Sprintf("passthrough:///127.0.0.1:%v", port)},
+	} {
+		if err = srv.AddService(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clients := srv.clients.list()
+	for _, cli := range clients {
+		waitState(t, cli, BackendReady)
+	}
+
+	const service, method = "helloworld.Greeter", "SayHello"
+	tests := []struct {
+		name     string
+		selector string
+		method   string
+		want     *backend
+		err      error
+	}{
+		{name: "empty selector", want: clients[0]},
+		{name: "id", selector: clients[1].id, want: clients[1]},
+		{name: "name", selector: "other", want: clients[2]},
+		{name: "target", selector: clients[1].Target(), want: clients[1]},
+		{name: "ambiguous name", selector: "hello", err: errBackendAmbiguous},
+		{name: "unknown selector", selector: "missing", err: errBackendNotFound},
+		{name: "unknown method", selector: "other", method: "SayBye", err: errBackendNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := method
+			if len(tt.method) > 0 {
+				m = tt.method
+			}
+			got, err := srv.selectBackend(tt.selector, service, m)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got.Target(), tt.want.Target())
+			}
+		})
+	}
+
+	// 三个后端提供同一服务, OpenAPI文档中只有一个
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rpc/openapi.json", nil)
+	srv.routerOpenAPI(c)
+	var doc struct {
+		Tags []struct {
+			Name string `json:"name"`
+		} `json:"tags"`
+	}
+	if err = json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Tags) != len(clients[0].GetServerInfo().Services) {
+		t.Fatalf("tags %+v", doc.Tags)
+	}
+}
+
+func serveHello(t *testing.T, port int) *grpc.Server {
+	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	helloworld.RegisterGreeterServer(srv, &examples.HelloService{})
+	reflection.Register(srv)
+	go func() { _ = srv.Serve(lis) }()
+
+	return srv
+}
+
+func waitState(t *testing.T, cli *backend, state string) {
+	deadline := time.Now().Add(time.Second * 10)
+	for time.Now().Before(deadline) {
+		if cli.json().State == state {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	t.Fatalf("backend %v, want %v", cli.json().State, state)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/bench"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+type JsonBenchRequest struct {
+	Header  map[string]string `json:"header"`
+	Data    json.RawMessage   `json:"data"`
+	Confirm string            `json:"confirm,omitempty"` // 只读服务的非安全方法, 使用上次返回的确认token
+	Backend string            `json:"backend,omitempty"` // 后端id, 名称或target
+
+	bench.Options
+}
+
+// routerBench 压测method, 请求头Accept为text/event-stream时推送进度
+func (tis *HttpServer) routerBench(c *gin.Context) {
+	serviceName := c.Param("ServiceName")
+	methodName := c.Param("MethodName")
+
+	var request JsonBenchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := request.Options.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tis.auth.Authorize(c.Request.Context(), serviceName, methodName); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	body, err := request.Data.MarshalJSON()
+	if err != nil || len(request.Data) == 0 {
+		body = []byte("{}")
+	}
+
+	cli, err := tis.selectBackend(request.Backend, serviceName, methodName)
+	if err != nil {
+		abortSelect(c, err)
+		return
+	}
+
+	if err = tis.checkSafe(cli, serviceName, methodName, request.Confirm, true); err != nil {
+		abortConfirm(c, err)
+		return
+	}
+
+	e := newEvent(c.Request.Context(), audit.ActionBench)
+	e.Target = cli.Target()
+	e.Service = serviceName
+	e.Method = methodName
+	e.Header = metadata.New(request.Header)
+	e.Request = body
+	tis.addEvent(c, e)
+
+	var invoke = func(ctx context.Context) error {
+		_, _, _, err := cli.InvokeRPC(ctx, serviceName, methodName, string(body), request.Header)
+		return err
+	}
+
+	if c.GetHeader("Accept") != "text/event-stream" {
+		c.JSON(http.StatusOK, bench.Run(c.Request.Context(), request.Options, invoke, 0, nil))
+		return
+	}
+
+	reports := make(chan *bench.Report, 16)
+	go func() {
+		defer close(reports)
+		bench.Run(c.Request.Context(), request.Options, invoke, time.Millisecond*500, func(report *bench.Report) {
+			select {
+			case reports <- report:
+			case <-c.Request.Context().Done():
+			}
+		})
+	}()
+
+	c.Stream(func(w io.Writer) bool {
+		report, ok := <-reports
+		if !ok {
+			return false
+		}
+
+		if report.Done {
+			c.SSEvent("done", report)
+		} else {
+			c.SSEvent("progress", report)
+		}
+		return true
+	})
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/general252/grpc_invoke/pkg/jsonpath"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type JsonCompareRequest struct {
+	Header   map[string]string `json:"header"`
+	Data     json.RawMessage   `json:"data"`
+	Backends []string          `json:"backends,omitempty"` // 后端id, 名称或target, 为空时使用全部有该方法的后端
+}
+
+type JsonCompareResult struct {
+	Backend     string         `json:"backend"` // 后端id
+	BackendName string         `json:"backend_name,omitempty"`
+	Target      string         `json:"target"`
+	Code        string         `json:"code"` // grpc状态码
+	Error       string         `json:"error,omitempty"`
+	DurationMs  float64        `json:"duration_ms"`
+	Header      metadata.MD    `json:"header"`
+	Trailer     metadata.MD    `json:"trailer"`
+	Data        map[string]any `json:"data"`
+}
+
+type JsonCompareReply struct {
+	Results []*JsonCompareResult  `json:"results"`
+	Diff    []jsonpath.Difference `json:"diff"` // 调用成功的回复中不同的字段, values与results的顺序一致, 失败的为null
+}
+
+// routerCompare 同时调用多个后端的同一方法, 返回各自的回复及不同的字段
+// 只读服务的非安全方法不支持确认, 直接返回错误
+func (tis *HttpServer) routerCompare(c *gin.Context) {
+	serviceName := c.Param("ServiceName")
+	methodName := c.Param("MethodName")
+
+	var request JsonCompareRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	body, err := request.Data.MarshalJSON()
+	if err != nil || len(request.Data) == 0 {
+		body = []byte("{}")
+	}
+
+	if err = tis.auth.Authorize(c.Request.Context(), serviceName, methodName); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var clients []*backend
+	if len(request.Backends) == 0 {
+		for _, cli := range tis.clients.list() {
+			if _, ok := cli.GetServerInfo().GetMethod(serviceName, methodName); ok {
+				clients = append(clients, cli)
+			}
+		}
+		if len(clients) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("not found [%v:%v]", serviceName, methodName),
+			})
+			return
+		}
+	}
+	for _, selector := range request.Backends {
+		cli, err := tis.selectBackend(selector, serviceName, methodName)
+		if err != nil {
+			abortSelect(c, err)
+			return
+		}
+		clients = append(clients, cli)
+	}
+
+	results := make([]*JsonCompareResult, len(clients))
+	var wg sync.WaitGroup
+	for i, cli := range clients {
+		wg.Add(1)
+		go func(i int, cli *backend) {
+			defer wg.Done()
+			results[i] = tis.compareInvoke(c, cli, serviceName, methodName, body, request.Header)
+		}(i, cli)
+	}
+	wg.Wait()
+
+	// 只比较调用成功的回复, 再按results的下标还原
+	var succeeded []int
+	var compared []any
+	for i, result := range results {
+		if result.Code == codes.OK.String() {
+			succeeded = append(succeeded, i)
+			compared = append(compared, result.Data)
+		}
+	}
+
+	diff := []jsonpath.Difference{}
+	if len(succeeded) > 1 {
+		for _, d := range jsonpath.Diff(compared...) {
+			item := jsonpath.Difference{Path: d.Path, Values: make([]any, len(results))}
+			for i, index := range succeeded {
+				item.Values[index] = d.Values[i]
+			}
+			for _, i := range d.Missing {
+				item.Missing = append(item.Missing, succeeded[i])
+			}
+			diff = append(diff, item)
+		}
+	}
+
+	c.JSON(http.StatusOK, &JsonCompareReply{
+		Results: results,
+		Diff:    diff,
+	})
+}
+
+func (tis *HttpServer) compareInvoke(c *gin.Context, cli *backend, service, method string, body []byte, head map[string]string) *JsonCompareResult {
+	result := &JsonCompareResult{
+		Backend:     cli.id,
+		BackendName: cli.config.Name,
+		Target:      cli.Target(),
+	}
+
+	start := time.Now()
+	if err := tis.checkSafe(cli, service, method, "", false); err != nil {
+		result.Code = codes.FailedPrecondition.String()
+		result.Error = err.Error()
+		return result
+	}
+
+	resp, header, trailer, err := cli.InvokeRPC(c.Request.Context(), service, method, string(body), head)
+	duration := float64(time.Since(start).Microseconds()) / 1000
+	tis.history.Add(&history.Record{
+		Kind:           history.KindGrpc,
+		Time:           start,
+		Target:         cli.Target(),
+		Service:        service,
+		Method:         method,
+		Header:         metadata.New(head),
+		Requests:       []json.RawMessage{body},
+		ResponseHeader: header,
+		Responses:      rawMessages(resp),
+		Trailer:        trailer,
+		Code:           int(status.Code(err)),
+		Error:          errorString(err),
+		DurationMs:     duration,
+	})
+
+	e := newEvent(c.Request.Context(), audit.ActionInvoke)
+	e.Target = cli.Target()
+	e.Service = service
+	e.Method = method
+	e.Header = metadata.New(head)
+	e.Request = body
+	e.Code = int(status.Code(err))
+	e.Error = errorString(err)
+	e.DurationMs = duration
+	tis.addEvent(c, e)
+
+	result.Code = status.Code(err).String()
+	result.Error = errorString(err)
+	result.DurationMs = duration
+	if err != nil {
+		return result
+	}
+
+	data, replyHeader, replyTrailer := tis.redactReply(service, method, []byte(resp), header, trailer)
+	result.Header, result.Trailer = replyHeader, replyTrailer
+
+	// 保留数字原样, 避免大整数比较时丢失精度
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	_ = decoder.Decode(&result.Data)
+	if result.Data == nil {
+		result.Data = map[string]any{}
+	}
+
+	return result
+}
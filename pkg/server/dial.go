@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+)
+
+// dialOptions 服务配置的连接参数, 消息大小和压缩只用于调用方法, 不影响反射
+func dialOptions(service config.Service) ([]grpc.DialOption, []grpc.CallOption) {
+	var opts []grpc.DialOption
+	var callOpts []grpc.CallOption
+
+	if service.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(service.MaxSendMsgSize))
+	}
+	if service.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(service.MaxRecvMsgSize))
+	}
+	if len(service.Compressor) > 0 {
+		callOpts = append(callOpts, grpc.UseCompressor(service.Compressor))
+	}
+
+	if ka := service.Keepalive; ka != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                time.Duration(ka.Time) * time.Second,
+			Timeout:             time.Duration(ka.Timeout) * time.Second,
+			PermitWithoutStream: ka.PermitWithoutStream,
+		}))
+	}
+	if len(service.Authority) > 0 {
+		opts = append(opts, grpc.WithAuthority(service.Authority))
+	}
+	if len(service.UserAgent) > 0 {
+		opts = append(opts, grpc.WithUserAgent(service.UserAgent))
+	}
+	if serviceConfig := defaultServiceConfig(service); len(serviceConfig) > 0 {
+		opts = append(opts, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+
+	return opts, callOpts
+}
+
+// defaultServiceConfig balancer覆盖service_config中的loadBalancingConfig
+func defaultServiceConfig(service config.Service) string {
+	if len(service.Balancer) == 0 {
+		return service.ServiceConfig
+	}
+
+	cfg := map[string]any{}
+	if len(service.ServiceConfig) > 0 {
+		if err := json.Unmarshal([]byte(service.ServiceConfig), &cfg); err != nil {
+			log.Printf("service_config [%v] %v", service.Name, err)
+			return service.ServiceConfig
+		}
+	}
+	delete(cfg, "loadBalancingPolicy")
+	cfg["loadBalancingConfig"] = []any{map[string]any{service.Balancer: map[string]any{}}}
+
+	data, _ := json.Marshal(cfg)
+	return string(data)
+}
@@ -0,0 +1,583 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/auth"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/general252/grpc_invoke/pkg/mock"
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// rawFrame 不解码的消息, 代理原样转发
+type rawFrame struct {
+	data []byte
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	frame, ok := v.(*rawFrame)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want *rawFrame", v)
+	}
+	return frame.data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	frame, ok := v.(*rawFrame)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want *rawFrame", v)
+	}
+	frame.data = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// recvWait 后端结束后等待转发客户端消息的goroutine退出的时间
+// 双向流的客户端可能在收到状态前不会结束发送, 不能无限等待
+const recvWait = time.Millisecond * 200
+
+// GrpcProxy 透明代理, 转发到已注册的后端并录制到历史
+type GrpcProxy struct {
+	// Authorize 不为空时转发前检查, 返回grpc status错误时拒绝
+	Authorize func(ctx context.Context, service, method string) error
+	// ForwardAuthorization 不为空且返回false时不转发authorization
+	ForwardAuthorization func() bool
+
+	name    string
+	session string
+	backend *stub.Stub
+	history *history.Store
+
+	srv *grpc.Server
+	lis net.Listener
+}
+
+func NewGrpcProxy(name string, backend *stub.Stub, store *history.Store) *GrpcProxy {
+	tis := &GrpcProxy{
+		name:    name,
+		session: fmt.Sprintf("%v-%v", name, time.Now().Format("20060102150405")),
+		backend: backend,
+		history: store,
+	}
+
+	tis.srv = grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(tis.handler),
+	)
+
+	return tis
+}
+
+// Start 监听host:port, host为空时只监听127.0.0.1, port为0时随机分配
+func (tis *GrpcProxy) Start(host string, port int) (int, error) {
+	if len(host) == 0 {
+		host = "127.0.0.1"
+	}
+
+	lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return 0, err
+	}
+
+	tis.lis = lis
+
+	go func() {
+		if err := tis.srv.Serve(lis); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return tis.Port(), nil
+}
+
+func (tis *GrpcProxy) Port() int {
+	if tis.lis == nil {
+		return 0
+	}
+
+	return tis.lis.Addr().(*net.TCPAddr).Port
+}
+
+func (tis *GrpcProxy) Session() string {
+	return tis.session
+}
+
+func (tis *GrpcProxy) Close() {
+	tis.srv.Stop()
+}
+
+func (tis *GrpcProxy) handler(_ any, serverStream grpc.ServerStream) error {
+	fullMethod, ok := grpc.MethodFromServerStream(serverStream)
+	if !ok {
+		return status.Errorf(codes.Internal, "unknown method")
+	}
+
+	service, method, err := splitMethodName(strings.TrimPrefix(fullMethod, "/"))
+	if err != nil {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+
+	if tis.Authorize != nil {
+		if err = tis.Authorize(serverStream.Context(), service, method); err != nil {
+			return err
+		}
+	}
+
+	var mtd *desc.MethodDescriptor
+	if v, ok := tis.backend.FindMethodDescriptor(service, method); ok {
+		mtd = v
+	}
+
+	ctx, cancel := context.WithCancel(serverStream.Context())
+	defer cancel()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	outgoing := md.Copy()
+	if tis.ForwardAuthorization != nil && !tis.ForwardAuthorization() {
+		delete(outgoing, "authorization")
+	}
+	record := &history.Record{
+		Session: tis.session,
+		Kind:    history.KindGrpc,
+		Time:    time.Now(),
+		Target:  tis.backend.Target(),
+		Service: service,
+		Method:  method,
+		Header:  md.Copy(),
+	}
+	var recordMux sync.Mutex
+	finished := false // 保存记录后不再修改
+
+	defer func() {
+		recordMux.Lock()
+		defer recordMux.Unlock()
+
+		record.DurationMs = float64(time.Since(record.Time).Microseconds()) / 1000
+		tis.history.Add(record)
+	}()
+
+	clientStream, err := tis.backend.GetConn().NewStream(
+		metadata.NewOutgoingContext(ctx, outgoing),
+		&grpc.StreamDesc{ServerStreams: true, ClientStreams: true},
+		fullMethod,
+		grpc.ForceCodec(rawCodec{}),
+	)
+	if err != nil {
+		record.Code = int(status.Code(err))
+		record.Error = err.Error()
+		return err
+	}
+
+	// 客户端 -> 后端, cancel后不再调用RecvMsg
+	recvDone := make(chan struct{})
+	go func() {
+		defer close(recvDone)
+
+		for ctx.Err() == nil {
+			frame := &rawFrame{}
+			if err := serverStream.RecvMsg(frame); err == io.EOF {
+				_ = clientStream.CloseSend()
+				return
+			} else if err != nil {
+				cancel()
+				return
+			}
+
+			recordMux.Lock()
+			if mtd != nil && !finished {
+				record.Requests = append(record.Requests, decodeFrame(mtd.GetInputType(), frame.data))
+			}
+			recordMux.Unlock()
+
+			if err := clientStream.SendMsg(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	// 在保存记录之前执行, 等待上面的goroutine退出
+	defer func() {
+		cancel()
+		select {
+		case <-recvDone:
+		case <-time.After(recvWait):
+		}
+
+		recordMux.Lock()
+		finished = true
+		recordMux.Unlock()
+	}()
+
+	// 后端 -> 客户端
+	for i := 0; ; i++ {
+		frame := &rawFrame{}
+		err := clientStream.RecvMsg(frame)
+
+		if i == 0 {
+			if header, err := clientStream.Header(); err == nil {
+				_ = serverStream.SendHeader(header)
+
+				recordMux.Lock()
+				record.ResponseHeader = header
+				recordMux.Unlock()
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			serverStream.SetTrailer(clientStream.Trailer())
+
+			recordMux.Lock()
+			record.Trailer = clientStream.Trailer()
+			record.Code = int(status.Code(err))
+			record.Error = status.Convert(err).Message()
+			recordMux.Unlock()
+			return err
+		}
+
+		recordMux.Lock()
+		if mtd != nil {
+			record.Responses = append(record.Responses, decodeFrame(mtd.GetOutputType(), frame.data))
+		}
+		recordMux.Unlock()
+
+		if err = serverStream.SendMsg(frame); err != nil {
+			return err
+		}
+	}
+
+	serverStream.SetTrailer(clientStream.Trailer())
+
+	recordMux.Lock()
+	record.Trailer = clientStream.Trailer()
+	recordMux.Unlock()
+
+	return nil
+}
+
+// decodeFrame 使用反射得到的描述将消息转为json
+func decodeFrame(md *desc.MessageDescriptor, data []byte) json.RawMessage {
+	msg := dynamic.NewMessage(md)
+	if err := msg.Unmarshal(data); err != nil {
+		log.Println(err)
+		v, _ := json.Marshal(data)
+		return v
+	}
+
+	v, err := msg.MarshalJSON()
+	if err != nil {
+		log.Println(err)
+		v, _ = json.Marshal(data)
+	}
+
+	return v
+}
+
+// ReplayRules 将录制的会话转换为模拟规则, 同一方法以最后一次调用为准
+func ReplayRules(records []*history.Record, files []*desc.FileDescriptor) map[string]*mock.MethodRule {
+	rules := map[string]*mock.MethodRule{}
+	for _, record := range records {
+		if record.Kind != history.KindGrpc {
+			continue
+		}
+
+		rule := &mock.MethodRule{
+			Header:  flattenMetadata(record.ResponseHeader),
+			Trailer: flattenMetadata(record.Trailer),
+		}
+
+		if record.Code != 0 {
+			rule.Error = &mock.JsonError{
+				Code:    codes.Code(record.Code),
+				Message: record.Error,
+			}
+		} else if len(record.Responses) > 0 {
+			rule.Response = record.Responses[0]
+			if isServerStreaming(files, record.Service, record.Method) {
+				rule.Responses = record.Responses
+			}
+		}
+
+		rules[fmt.Sprintf("%v/%v", record.Service, record.Method)] = rule
+	}
+
+	return rules
+}
+
+func isServerStreaming(files []*desc.FileDescriptor, service, method string) bool {
+	for _, fd := range files {
+		if sd := fd.FindService(service); sd != nil {
+			if mtd := sd.FindMethodByName(method); mtd != nil {
+				return mtd.IsServerStreaming()
+			}
+		}
+	}
+
+	return false
+}
+
+func flattenMetadata(md map[string][]string) map[string]string {
+	if len(md) == 0 {
+		return nil
+	}
+
+	result := map[string]string{}
+	for k, v := range md {
+		if len(v) > 0 {
+			result[k] = v[0]
+		}
+	}
+
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type JsonAddProxyRequest struct {
+	Name    string `json:"name"`
+	Backend string `json:"backend"` // 已注册的后端id, 名称或target
+	Host    string `json:"host"`    // 或使用host, port
+	Port    int    `json:"port"`
+	Target  string `json:"target"` // 或使用target
+
+	ListenHost string `json:"listen_host"` // 代理监听地址, 默认127.0.0.1
+	ListenPort int    `json:"listen_port"` // 代理监听端口, 0 随机端口
+}
+
+type JsonProxy struct {
+	Name       string `json:"name"`
+	Session    string `json:"session"`
+	Backend    string `json:"backend"`
+	ListenPort int    `json:"listen_port"`
+}
+
+type JsonReplayRequest struct {
+	Session string `json:"session"`
+	Name    string `json:"name"` // 模拟服务名称
+	Port    int    `json:"port"`
+}
+
+func (tis *HttpServer) routerAddProxy(c *gin.Context) {
+	var request JsonAddProxyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	selector := request.Backend
+	if len(selector) == 0 {
+		selector = request.Target
+	}
+	if len(selector) == 0 {
+		selector = fmt.Sprintf("%v:%v", request.Host, request.Port)
+	}
+
+	backend, err := tis.selectBackend(selector, "", "")
+	if err != nil {
+		abortSelect(c, err)
+		return
+	}
+
+	tis.proxiesMux.Lock()
+	defer tis.proxiesMux.Unlock()
+
+	if _, ok := tis.proxies[request.Name]; ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "already exists",
+		})
+		return
+	}
+
+	proxy := NewGrpcProxy(request.Name, backend.Stub, tis.history)
+	proxy.Authorize = tis.proxyAuthorizer(backend)
+	proxy.ForwardAuthorization = func() bool {
+		return !tis.auth.Enabled() || backend.config.PassAuthorization
+	}
+	if _, err = proxy.Start(request.ListenHost, request.ListenPort); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tis.proxies[request.Name] = proxy
+
+	c.JSON(http.StatusOK, &JsonProxy{
+		Name:       request.Name,
+		Session:    proxy.Session(),
+		Backend:    backend.Target(),
+		ListenPort: proxy.Port(),
+	})
+}
+
+// proxyAuthorizer 与调用接口相同的检查: 启用认证时使用metadata中的authorization登录并检查权限, 只读服务只能调用安全的方法
+func (tis *HttpServer) proxyAuthorizer(b *backend) func(ctx context.Context, service, method string) error {
+	return func(ctx context.Context, service, method string) error {
+		if tis.auth.Enabled() {
+			md, _ := metadata.FromIncomingContext(ctx)
+			r := &http.Request{Header: http.Header{}}
+			for _, v := range md.Get("authorization") {
+				r.Header.Add("Authorization", v)
+			}
+
+			id, ok := tis.auth.Authenticate(r)
+			if !ok {
+				return status.Error(codes.Unauthenticated, "login required")
+			}
+			if err := tis.auth.Authorize(auth.WithIdentity(ctx, id), service, method); err != nil {
+				return status.Error(codes.PermissionDenied, err.Error())
+			}
+		}
+
+		if err := tis.checkSafe(b, service, method, "", false); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil
+	}
+}
+
+// closeProxies 停止转发到已删除后端的代理
+func (tis *HttpServer) closeProxies(cli *stub.Stub) {
+	tis.proxiesMux.Lock()
+	defer tis.proxiesMux.Unlock()
+
+	for name, proxy := range tis.proxies {
+		if proxy.backend == cli {
+			proxy.Close()
+			delete(tis.proxies, name)
+			log.Printf("proxy [%v] stopped, backend %v removed", name, cli.Target())
+		}
+	}
+}
+
+func (tis *HttpServer) routerProxies(c *gin.Context) {
+	tis.proxiesMux.Lock()
+	defer tis.proxiesMux.Unlock()
+
+	var response []*JsonProxy
+	for name, proxy := range tis.proxies {
+		response = append(response, &JsonProxy{
+			Name:       name,
+			Session:    proxy.Session(),
+			Backend:    proxy.backend.Target(),
+			ListenPort: proxy.Port(),
+		})
+	}
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].Name < response[j].Name
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (tis *HttpServer) routerDeleteProxy(c *gin.Context) {
+	tis.proxiesMux.Lock()
+	defer tis.proxiesMux.Unlock()
+
+	proxy, ok := tis.proxies[c.Param("Name")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	proxy.Close()
+	delete(tis.proxies, c.Param("Name"))
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (tis *HttpServer) routerHistory(c *gin.Context) {
+	var q history.Query
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tis.history.Find(q))
+}
+
+func (tis *HttpServer) routerHistorySessions(c *gin.Context) {
+	c.JSON(http.StatusOK, tis.history.Sessions())
+}
+
+func (tis *HttpServer) routerClearHistory(c *gin.Context) {
+	tis.history.Clear()
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// routerReplay 将录制的会话作为模拟服务启动
+func (tis *HttpServer) routerReplay(c *gin.Context) {
+	var request JsonReplayRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	records := tis.history.Find(history.Query{Session: request.Session, Kind: history.KindGrpc})
+	if len(records) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "session not found",
+		})
+		return
+	}
+
+	// 使用录制时后端的描述
+	var files []*desc.FileDescriptor
+	for _, cli := range tis.clients.list() {
+		if cli.Target() == records[0].Target {
+			files = cli.GetFileDescriptors()
+		}
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "no descriptors",
+		})
+		return
+	}
+
+	srv, err := tis.AddMock(request.Name, files, request.Port, ReplayRules(records, files))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"port": srv.Port(),
+	})
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/examples"
+	"github.com/general252/grpc_invoke/examples/helloworld"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/general252/grpc_invoke/pkg/mock"
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// TestGrpcProxyReplay 经代理调用并录制, 再用录制的会话启动模拟服务回放
+func TestGrpcProxyReplay(t *testing.T) {
+	port, err := examples.RunHelloServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	backend := stub.NewStub("127.0.0.1", port)
+	if err = backend.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	store := history.NewStore("", 100)
+	proxy := NewGrpcProxy("test", backend, store)
+	defer proxy.Close()
+	proxyPort, err := proxy.Start("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := sayHello(ctx, t, proxyPort, "alice")
+	if reply.GetMessage() != "hello alice" {
+		t.Fatalf("proxy reply %v", reply)
+	}
+
+	records := store.Find(history.Query{Session: proxy.Session()})
+	if len(records) != 1 {
+		t.Fatalf("want 1 record, got %v", len(records))
+	}
+	record := records[0]
+	if record.Service != "helloworld.Greeter" || record.Method != "SayHello" ||
+		len(record.Requests) != 1 || len(record.Responses) != 1 || record.Code != 0 {
+		t.Fatalf("record %+v", record)
+	}
+
+	files := backend.GetFileDescriptors()
+	srv, err := mock.NewServer(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	for key, rule := range ReplayRules(records, files) {
+		service, method, err := splitMethodName(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.SetRule(service, method, rule)
+	}
+	mockPort, err := srv.Start(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 回放录制时的回复, 与请求无关
+	if reply = sayHello(ctx, t, mockPort, "bob"); reply.GetMessage() != "hello alice" {
+		t.Fatalf("replay reply %v", reply)
+	}
+}
+
+// TestGrpcProxyReadOnly 只读服务经代理也只能调用安全的方法, 删除服务后停止代理
+func TestGrpcProxyReadOnly(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	port, err := examples.RunHelloServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	if err = srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+
+	service := config.Service{Name: "hello", Host: "127.0.0.1", Port: port, ReadOnly: true}
+	if err = srv.AddService(service); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, srv, "hello")
+
+	code, body := request(http.MethodPost, fmt.Sprintf("http://%v/rpc/proxies", srv.Addr()), `{"name": "p", "backend": "hello"}`)
+	if code != http.StatusOK {
+		t.Fatalf("add proxy: %v %v", code, body)
+	}
+	var proxy JsonProxy
+	if err = json.Unmarshal([]byte(body), &proxy); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, fmt.Sprintf("127.0.0.1:%v", proxy.ListenPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := helloworld.NewGreeterClient(conn)
+
+	if _, err = cli.SayHello(ctx, &helloworld.HelloRequest{Name: "a"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("want FailedPrecondition, got %v", err)
+	}
+	if _, err = cli.GetVersion(ctx, &helloworld.GetVersionReq{}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.RemoveService(service.Address())
+	srv.proxiesMux.Lock()
+	n := len(srv.proxies)
+	srv.proxiesMux.Unlock()
+	if n != 0 {
+		t.Fatalf("proxy not stopped")
+	}
+}
+
+func sayHello(ctx context.Context, t *testing.T, port int, name string) *helloworld.HelloReply {
+	conn, err := grpc.DialContext(ctx, fmt.Sprintf("127.0.0.1:%v", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reply, err := helloworld.NewGreeterClient(conn).SayHello(ctx, &helloworld.HelloRequest{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reply
+}
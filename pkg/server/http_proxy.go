@@ -0,0 +1,419 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/auth"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRecordBody 记录到历史的body最大长度, 超过时不记录body
+const maxRecordBody = 1 << 20
+
+var errHttpProxyNotFound = errors.New("not found")
+
+// HttpProxy 按前缀转发http请求到upstream, 请求和回复记录到history
+type HttpProxy struct {
+	config   config.HttpProxy
+	upstream *url.URL
+	store    *history.Store
+	runtime  bool // 通过接口添加, 不保存到配置文件
+}
+
+func NewHttpProxy(cfg config.HttpProxy, store *history.Store) (*HttpProxy, error) {
+	if len(cfg.Name) == 0 {
+		return nil, fmt.Errorf("name is empty")
+	}
+	if !strings.HasPrefix(cfg.Prefix, "/") {
+		return nil, fmt.Errorf("prefix %q must start with /", cfg.Prefix)
+	}
+
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if len(upstream.Scheme) == 0 || len(upstream.Host) == 0 {
+		return nil, fmt.Errorf("upstream %q must be an absolute url", cfg.Upstream)
+	}
+
+	return &HttpProxy{
+		config:   cfg,
+		upstream: upstream,
+		store:    store,
+	}, nil
+}
+
+func (tis *HttpProxy) Config() config.HttpProxy {
+	return tis.config
+}
+
+// match path是否在前缀下, 返回前缀长度
+func (tis *HttpProxy) match(path string) (int, bool) {
+	prefix := strings.TrimSuffix(tis.config.Prefix, "/")
+	if path == prefix || strings.HasPrefix(path, prefix+"/") {
+		return len(prefix), true
+	}
+
+	return 0, false
+}
+
+// ServeHTTP path为去掉 /http 后的路径
+func (tis *HttpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, path string) {
+	cfg := tis.config
+	if cfg.StripPrefix {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(cfg.Prefix, "/"))
+	}
+
+	record := &history.Record{
+		Kind:    history.KindHttp,
+		Time:    time.Now(),
+		Target:  tis.upstream.Host,
+		Service: cfg.Name,
+		Method:  fmt.Sprintf("%v %v", r.Method, path),
+	}
+
+	var requestBody []byte
+	if r.Body != nil && r.ContentLength <= maxRecordBody {
+		var err error
+		if requestBody, err = io.ReadAll(io.LimitReader(r.Body, maxRecordBody+1)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(requestBody) > maxRecordBody {
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(requestBody), r.Body))
+			requestBody = nil
+		} else {
+			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+	}
+	record.Requests = rawBody(requestBody)
+
+	done := func() {
+		record.DurationMs = float64(time.Since(record.Time).Microseconds()) / 1000
+		tis.store.Add(record)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = tis.upstream.Scheme
+			req.URL.Host = tis.upstream.Host
+			req.URL.Path = singleJoiningSlash(tis.upstream.Path, path)
+			req.URL.RawPath = ""
+			if len(tis.upstream.RawQuery) > 0 {
+				req.URL.RawQuery = strings.TrimSuffix(tis.upstream.RawQuery+"&"+req.URL.RawQuery, "&")
+			}
+			req.Host = tis.upstream.Host
+
+			for _, k := range cfg.RemoveHeader {
+				req.Header.Del(k)
+			}
+			for k, v := range cfg.SetHeader {
+				req.Header.Set(k, v)
+			}
+			if auth := cfg.Auth; auth != nil {
+				if len(auth.Token) > 0 {
+					req.Header.Set("Authorization", "Bearer "+auth.Token)
+				} else {
+					req.SetBasicAuth(auth.Username, auth.Password)
+				}
+			}
+
+			record.Header = req.Header.Clone()
+		},
+		ModifyResponse: func(res *http.Response) error {
+			record.Code = res.StatusCode
+			record.ResponseHeader = res.Header.Clone()
+			res.Body = &recordBody{ReadCloser: res.Body, done: func(body []byte, trailer http.Header) {
+				record.Responses = rawBody(body)
+				if len(trailer) > 0 {
+					record.Trailer = trailer
+				}
+				done()
+			}, trailer: func() http.Header { return res.Trailer }}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("proxy [%v] %v", cfg.Name, err)
+			record.Code = http.StatusBadGateway
+			record.Error = err.Error()
+			done()
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// recordBody 转发回复的同时保存body, 关闭时回调
+type recordBody struct {
+	io.ReadCloser
+	buf     bytes.Buffer
+	over    bool
+	closed  bool
+	done    func(body []byte, trailer http.Header)
+	trailer func() http.Header
+}
+
+func (tis *recordBody) Read(p []byte) (int, error) {
+	n, err := tis.ReadCloser.Read(p)
+	if !tis.over {
+		if tis.buf.Len()+n > maxRecordBody {
+			tis.over = true
+			tis.buf.Reset()
+		} else {
+			tis.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (tis *recordBody) Close() error {
+	err := tis.ReadCloser.Close()
+	if !tis.closed {
+		tis.closed = true
+		var body []byte
+		if !tis.over {
+			body = tis.buf.Bytes()
+		}
+		tis.done(body, tis.trailer())
+	}
+	return err
+}
+
+// rawBody json直接保存, 其他内容保存为json字符串
+func rawBody(body []byte) []json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return []json.RawMessage{body}
+	}
+
+	data, _ := json.Marshal(string(body))
+	return []json.RawMessage{data}
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+
+	return a + b
+}
+
+// AddHttpProxy 添加配置文件中的http代理路由, 名称不能重复, 与运行时添加的重名时替换
+func (tis *HttpServer) AddHttpProxy(cfg config.HttpProxy) error {
+	proxy, err := NewHttpProxy(cfg, tis.history)
+	if err != nil {
+		return err
+	}
+
+	tis.httpProxiesMux.Lock()
+	defer tis.httpProxiesMux.Unlock()
+
+	if old, ok := tis.httpProxies[cfg.Name]; ok {
+		if !old.runtime {
+			return fmt.Errorf("already exists")
+		}
+		log.Printf("http proxy [%v] replaced by config", cfg.Name)
+	}
+
+	tis.httpProxies[cfg.Name] = proxy
+	return nil
+}
+
+// AddRuntimeHttpProxy 运行时添加http代理路由, 只在本次运行期间有效, 不保存到配置文件
+func (tis *HttpServer) AddRuntimeHttpProxy(cfg config.HttpProxy) error {
+	proxy, err := NewHttpProxy(cfg, tis.history)
+	if err != nil {
+		return err
+	}
+	proxy.runtime = true
+
+	tis.httpProxiesMux.Lock()
+	defer tis.httpProxiesMux.Unlock()
+
+	if _, ok := tis.httpProxies[cfg.Name]; ok {
+		return fmt.Errorf("already exists")
+	}
+
+	tis.httpProxies[cfg.Name] = proxy
+	return nil
+}
+
+// RemoveHttpProxy 删除配置文件中的http代理路由
+func (tis *HttpServer) RemoveHttpProxy(name string) bool {
+	tis.httpProxiesMux.Lock()
+	defer tis.httpProxiesMux.Unlock()
+
+	if proxy, ok := tis.httpProxies[name]; !ok || proxy.runtime {
+		return false
+	}
+
+	delete(tis.httpProxies, name)
+	return true
+}
+
+// RemoveRuntimeHttpProxy 删除运行时添加的http代理路由, 配置文件中的需要修改配置文件
+func (tis *HttpServer) RemoveRuntimeHttpProxy(name string) error {
+	tis.httpProxiesMux.Lock()
+	defer tis.httpProxiesMux.Unlock()
+
+	proxy, ok := tis.httpProxies[name]
+	if !ok {
+		return errHttpProxyNotFound
+	}
+	if !proxy.runtime {
+		return fmt.Errorf("http proxy [%v] is defined in %v", name, filepath.Base(config.GetConfig().Filename()))
+	}
+
+	delete(tis.httpProxies, name)
+	return nil
+}
+
+// findHttpProxy 最长前缀匹配
+func (tis *HttpServer) findHttpProxy(path string) (*HttpProxy, bool) {
+	tis.httpProxiesMux.Lock()
+	defer tis.httpProxiesMux.Unlock()
+
+	var found *HttpProxy
+	var length = -1
+	for _, proxy := range tis.httpProxies {
+		if n, ok := proxy.match(path); ok && n > length {
+			found, length = proxy, n
+		}
+	}
+
+	return found, found != nil
+}
+
+func (tis *HttpServer) httpProxy(c *gin.Context) {
+	path := c.Param("ProxyPath")
+
+	proxy, ok := tis.findHttpProxy(path)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "no proxy route for " + path,
+		})
+		return
+	}
+
+	if err := tis.auth.Authorize(c.Request.Context(), proxy.config.Name, c.Request.Method+" "+path); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	header := c.Request.Header.Clone()
+	if !proxy.config.PassAuthorization {
+		stripCredentials(c.Request.Header, tis.auth.Enabled())
+	}
+
+	start := time.Now()
+	proxy.ServeHTTP(c.Writer, c.Request, path)
+
+	e := newEvent(c.Request.Context(), audit.ActionInvoke)
+	e.Target = proxy.config.Upstream
+	e.Service = proxy.config.Name
+	e.Method = c.Request.Method + " " + path
+	e.Header = header
+	e.Code = c.Writer.Status()
+	e.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	tis.addEvent(c, e)
+}
+
+// stripCredentials 不把本工具的凭证转发给upstream: 删除session cookie, 启用认证时还删除Authorization
+func stripCredentials(header http.Header, authorization bool) {
+	if authorization {
+		header.Del("Authorization")
+	}
+
+	var cookies []string
+	for _, cookie := range (&http.Request{Header: header}).Cookies() {
+		if cookie.Name != auth.SessionCookie {
+			cookies = append(cookies, cookie.String())
+		}
+	}
+	header.Del("Cookie")
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+}
+
+func (tis *HttpServer) routerAddHttpProxy(c *gin.Context) {
+	var request config.HttpProxy
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tis.AddRuntimeHttpProxy(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+type JsonHttpProxy struct {
+	config.HttpProxy
+	Runtime bool `json:"runtime,omitempty"` // 运行时添加, 重启后失效
+}
+
+func (tis *HttpServer) routerHttpProxies(c *gin.Context) {
+	tis.httpProxiesMux.Lock()
+	var response []JsonHttpProxy
+	for _, proxy := range tis.httpProxies {
+		cfg := proxy.Config()
+		if cfg.Auth != nil {
+			// 不返回密码
+			cfg.Auth = &config.HttpProxyAuth{Username: cfg.Auth.Username}
+		}
+		response = append(response, JsonHttpProxy{HttpProxy: cfg, Runtime: proxy.runtime})
+	}
+	tis.httpProxiesMux.Unlock()
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].Name < response[j].Name
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (tis *HttpServer) routerDeleteHttpProxy(c *gin.Context) {
+	if err := tis.RemoveRuntimeHttpProxy(c.Param("Name")); err != nil {
+		code := http.StatusBadRequest
+		if err == errHttpProxyNotFound {
+			code = http.StatusNotFound
+		}
+		c.JSON(code, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
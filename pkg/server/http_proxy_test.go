@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/auth"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// TestRuntimeHttpProxy 运行时添加的代理与配置文件中的同名时由配置文件替换, 接口只能删除运行时添加的
+func TestRuntimeHttpProxy(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	defer srv.Close()
+
+	cfg := config.HttpProxy{Name: "api", Prefix: "/api", Upstream: "http://127.0.0.1:1"}
+	if err := srv.AddRuntimeHttpProxy(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddRuntimeHttpProxy(cfg); err == nil {
+		t.Fatal("want already exists")
+	}
+	if srv.RemoveHttpProxy(cfg.Name) {
+		t.Fatal("config removed runtime proxy")
+	}
+
+	if errs := srv.applyConfig(nil, []config.HttpProxy{cfg}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if err := srv.RemoveRuntimeHttpProxy(cfg.Name); err == nil || err == errHttpProxyNotFound {
+		t.Fatalf("remove config proxy: %v", err)
+	}
+	if err := srv.AddRuntimeHttpProxy(cfg); err == nil {
+		t.Fatal("runtime proxy replaced config")
+	}
+
+	if errs := srv.applyConfig(nil, nil); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if _, ok := srv.findHttpProxy("/api/x"); ok {
+		t.Fatal("proxy not removed")
+	}
+}
+
+// TestHttpProxyCredentials 未设置pass_authorization时不转发本工具的session cookie
+func TestHttpProxyCredentials(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	received := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	srv := NewHttpServer()
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+
+	for _, cfg := range []config.HttpProxy{
+		{Name: "api", Prefix: "/api", Upstream: upstream.URL},
+		{Name: "pass", Prefix: "/pass", Upstream: upstream.URL, PassAuthorization: true},
+	} {
+		if err := srv.AddHttpProxy(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send := func(path string) http.Header {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%v/http%v", srv.Addr(), path), nil)
+		req.Header.Set("Authorization", "Bearer backend")
+		req.Header.Set("Cookie", auth.SessionCookie+"=s; theme=dark")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return <-received
+	}
+
+	// 未启用认证时Authorization不是本工具的凭证, 照常转发
+	if header := send("/api/x"); header.Get("Cookie") != "theme=dark" || header.Get("Authorization") != "Bearer backend" {
+		t.Errorf("stripped %v", header)
+	}
+	if header := send("/pass/x"); header.Get("Cookie") != auth.SessionCookie+"=s; theme=dark" {
+		t.Errorf("passed %v", header)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer tool")
+	header.Set("Cookie", auth.SessionCookie+"=s")
+	stripCredentials(header, true)
+	if len(header) != 0 {
+		t.Errorf("auth enabled %v", header)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LogLevelDebug  = "debug"  // gin调试模式, 输出路由和请求日志
+	LogLevelInfo   = "info"   // 输出请求日志
+	LogLevelError  = "error"  // 不输出请求日志
+	LogLevelSilent = "silent" // 不输出任何日志
+)
+
+var logLevel = LogLevelInfo
+
+// SetLogLevel 需在Serve之前调用
+func SetLogLevel(level string) error {
+	switch level {
+	case LogLevelDebug:
+		gin.SetMode(gin.DebugMode)
+	case LogLevelInfo, LogLevelError:
+		gin.SetMode(gin.ReleaseMode)
+	case LogLevelSilent:
+		gin.SetMode(gin.ReleaseMode)
+		log.SetOutput(io.Discard)
+	default:
+		return fmt.Errorf("unknown log level %q, want debug, info, error or silent", level)
+	}
+
+	logLevel = level
+	return nil
+}
+
+// requestLogger 与gin默认格式相同, 隐藏查询参数中的敏感字段
+func (tis *HttpServer) requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		var statusColor, methodColor, resetColor string
+		if param.IsOutputColor() {
+			statusColor = param.StatusCodeColor()
+			methodColor = param.MethodColor()
+			resetColor = param.ResetColor()
+		}
+
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, param.StatusCode, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			tis.getRedactor().Query(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
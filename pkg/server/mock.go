@@ -0,0 +1,250 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/mock"
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/desc"
+)
+
+type JsonAddMockRequest struct {
+	Name         string                      `json:"name"`          // 模拟服务名称
+	Service      string                      `json:"service"`       // 从已注册的gRPC服务复制描述, 如 helloworld.Greeter
+	Protoset     string                      `json:"protoset"`      // 或使用工作区中的protoset文件, 相对于工作区目录
+	ProtosetData []byte                      `json:"protoset_data"` // 或上传protoset文件的内容(base64)
+	Port         int                         `json:"port"`          // 0 随机端口
+	Methods      map[string]*mock.MethodRule `json:"methods"`       // key: package.Service/Method
+}
+
+type JsonMock struct {
+	Name     string                      `json:"name"`
+	Port     int                         `json:"port"`
+	Services []string                    `json:"services"`
+	Methods  map[string]*mock.MethodRule `json:"methods"`
+}
+
+// AddMock 启动模拟服务, 并注册到服务列表中以便调用
+func (tis *HttpServer) AddMock(name string, files []*desc.FileDescriptor, port int, rules map[string]*mock.MethodRule) (*mock.Server, error) {
+	tis.mocksMux.Lock()
+	defer tis.mocksMux.Unlock()
+
+	if _, ok := tis.mocks[name]; ok {
+		return nil, fmt.Errorf("already exists")
+	}
+
+	srv, err := mock.NewServer(files)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, rule := range rules {
+		service, method, err := splitMethodName(key)
+		if err != nil {
+			srv.Close()
+			return nil, err
+		}
+		srv.SetRule(service, method, rule)
+	}
+
+	if _, err = srv.Start(port); err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	if err = tis.AddService(mockService(name, srv)); err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	tis.mocks[name] = srv
+	log.Printf("mock [%v] listen on %v", name, srv.Port())
+
+	return srv, nil
+}
+
+func (tis *HttpServer) routerAddMock(c *gin.Context) {
+	var request JsonAddMockRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var files []*desc.FileDescriptor
+	if len(request.ProtosetData) > 0 {
+		v, err := mock.ParseProtoset(request.ProtosetData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		files = v
+	} else if len(request.Protoset) > 0 {
+		filename, err := workspaceFile(request.Protoset)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		v, err := mock.LoadProtoset(filename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		files = v
+	} else {
+		for _, cli := range tis.clients.list() {
+			for _, service := range cli.GetServerInfo().Services {
+				if service.Name == request.Service {
+					files = cli.GetFileDescriptors()
+				}
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "no descriptors",
+		})
+		return
+	}
+
+	if _, err := tis.AddMock(request.Name, files, request.Port, request.Methods); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// workspaceFile 工作区目录中的文件, 不允许访问工作区之外的文件, 包括链接到工作区之外的
+func workspaceFile(name string) (string, error) {
+	dir, err := filepath.EvalSymlinks(config.WorkspaceDir())
+	if err != nil {
+		return "", err
+	}
+
+	outside := func(filename string) bool {
+		rel, err := filepath.Rel(dir, filename)
+		return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+
+	filename := filepath.Clean(name)
+	if filepath.IsAbs(filename) {
+		// 工作区目录本身可能是链接
+		if rel, err := filepath.Rel(config.WorkspaceDir(), filename); err == nil {
+			filename = rel
+		}
+	}
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	if !outside(filename) {
+		if filename, err = filepath.EvalSymlinks(filename); err != nil {
+			return "", err
+		}
+	}
+	if outside(filename) {
+		return "", fmt.Errorf("%v is outside the workspace %v", name, config.WorkspaceDir())
+	}
+
+	return filename, nil
+}
+
+func (tis *HttpServer) routerMocks(c *gin.Context) {
+	tis.mocksMux.Lock()
+	defer tis.mocksMux.Unlock()
+
+	var response []*JsonMock
+	for name, srv := range tis.mocks {
+		item := &JsonMock{
+			Name:    name,
+			Port:    srv.Port(),
+			Methods: srv.GetRules(),
+		}
+		for _, sd := range srv.GetServiceDescriptors() {
+			item.Services = append(item.Services, sd.GetFullyQualifiedName())
+		}
+
+		response = append(response, item)
+	}
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].Name < response[j].Name
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (tis *HttpServer) routerSetMockRule(c *gin.Context) {
+	var rule *mock.MethodRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tis.mocksMux.Lock()
+	srv, ok := tis.mocks[c.Param("Name")]
+	tis.mocksMux.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	srv.SetRule(c.Param("ServiceName"), c.Param("MethodName"), rule)
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (tis *HttpServer) routerDeleteMock(c *gin.Context) {
+	tis.mocksMux.Lock()
+	defer tis.mocksMux.Unlock()
+
+	srv, ok := tis.mocks[c.Param("Name")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	service := mockService(c.Param("Name"), srv)
+	tis.RemoveService(service.Address())
+	srv.Close()
+	delete(tis.mocks, c.Param("Name"))
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// mockService 模拟服务注册到服务列表时使用的配置
+func mockService(name string, srv *mock.Server) config.Service {
+	return config.Service{Name: name, Host: "127.0.0.1", Port: srv.Port()}
+}
+
+// splitMethodName package.Service/Method
+func splitMethodName(name string) (service string, method string, err error) {
+	i := strings.LastIndex(name, "/")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("invalid method name [%v], want package.Service/Method", name)
+	}
+
+	return name[:i], name[i+1:], nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/general252/grpc_invoke/examples/helloworld"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestAddMockProtoset protoset只能使用工作区中的文件或上传的内容
+func TestAddMockProtoset(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	fd, err := desc.LoadFileDescriptor(helloworld.File_helloworld_helloworld_proto.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outside := filepath.Join(t.TempDir(), "hello.protoset")
+	if err = os.WriteFile(outside, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(config.WorkspacePath("hello.protoset"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(outside, config.WorkspacePath("link.protoset")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	if err = srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+	base := fmt.Sprintf("http://%v/rpc", srv.Addr())
+
+	tests := []struct {
+		name    string
+		request JsonAddMockRequest
+		code    int
+	}{
+		{name: "workspace file", request: JsonAddMockRequest{Protoset: "hello.protoset"}, code: http.StatusOK},
+		{name: "absolute workspace file", request: JsonAddMockRequest{Protoset: config.WorkspacePath("hello.protoset")}, code: http.StatusOK},
+		{name: "uploaded", request: JsonAddMockRequest{ProtosetData: data}, code: http.StatusOK},
+		{name: "outside", request: JsonAddMockRequest{Protoset: outside}, code: http.StatusBadRequest},
+		{name: "parent", request: JsonAddMockRequest{Protoset: "../" + filepath.Base(outside)}, code: http.StatusBadRequest},
+		{name: "symlink", request: JsonAddMockRequest{Protoset: "link.protoset"}, code: http.StatusBadRequest},
+		{name: "invalid data", request: JsonAddMockRequest{ProtosetData: []byte("invalid")}, code: http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.Name = fmt.Sprintf("mock%v", i)
+			body, _ := json.Marshal(&tt.request)
+			if code, body := request(http.MethodPost, base+"/mocks", string(body)); code != tt.code {
+				t.Errorf("%v %v", code, body)
+			}
+		})
+	}
+
+	// 上传的内容为base64
+	body := fmt.Sprintf(`{"name": "base64", "protoset_data": %q}`, base64.StdEncoding.EncodeToString(data))
+	if code, body := request(http.MethodPost, base+"/mocks", body); code != http.StatusOK {
+		t.Errorf("%v %v", code, body)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/general252/grpc_invoke/pkg/redact"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// updateRedact 使用新的隐藏规则, 审计日志在此之外使用audit中的规则
+func (tis *HttpServer) updateRedact(cfg *config.Redact, auditCfg *config.Audit) {
+	if cfg == nil {
+		cfg = &config.Redact{}
+	}
+
+	redactor := redact.New(cfg.Headers, cfg.Fields).WithResolver(tis.findMethod)
+
+	auditRedactor := redactor
+	if auditCfg != nil && (len(auditCfg.RedactHeaders) > 0 || len(auditCfg.RedactFields) > 0) {
+		headers := append(append([]string{}, cfg.Headers...), auditCfg.RedactHeaders...)
+		fields := append(append([]string{}, cfg.Fields...), auditCfg.RedactFields...)
+		auditRedactor = redact.New(headers, fields).WithResolver(tis.findMethod)
+	}
+	tis.audit.Update(auditCfg, auditRedactor)
+
+	tis.redactMux.Lock()
+	defer tis.redactMux.Unlock()
+
+	tis.redactor = redactor
+	tis.redactResponse = cfg.Response
+}
+
+func (tis *HttpServer) getRedactor() *redact.Redactor {
+	tis.redactMux.RLock()
+	defer tis.redactMux.RUnlock()
+
+	return tis.redactor
+}
+
+// findMethod 在已添加的服务中查找方法描述
+func (tis *HttpServer) findMethod(service, method string) (*desc.MethodDescriptor, bool) {
+	for _, cli := range tis.clients.list() {
+		if mtd, ok := cli.FindMethodDescriptor(service, method); ok {
+			return mtd, true
+		}
+	}
+
+	return nil, false
+}
+
+// redactRecord 保存历史前隐藏header, 请求和回复中的敏感内容
+func (tis *HttpServer) redactRecord(record *history.Record) {
+	redactor := tis.getRedactor()
+
+	record.Header = redactor.Header(record.Header)
+	record.ResponseHeader = redactor.Header(record.ResponseHeader)
+	record.Trailer = redactor.Header(record.Trailer)
+
+	for i, data := range record.Requests {
+		record.Requests[i] = redactor.Request(record.Service, record.Method, data)
+	}
+	for i, data := range record.Responses {
+		record.Responses[i] = redactor.Response(record.Service, record.Method, data)
+	}
+}
+
+// redactReply 配置了redact.response时隐藏返回给页面的回复
+func (tis *HttpServer) redactReply(service, method string, data []byte, header, trailer map[string][]string) ([]byte, map[string][]string, map[string][]string) {
+	tis.redactMux.RLock()
+	redactor, enabled := tis.redactor, tis.redactResponse
+	tis.redactMux.RUnlock()
+
+	if !enabled {
+		return data, header, trailer
+	}
+
+	return redactor.Response(service, method, data), redactor.Header(header), redactor.Header(trailer)
+}
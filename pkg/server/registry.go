@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+)
+
+// registry 已添加的服务, 修改时复制新的切片, list返回的快照不会再被修改, 遍历时不需要加锁
+type registry struct {
+	backends []*backend
+	mux      sync.RWMutex
+}
+
+// list 当前服务的快照
+func (tis *registry) list() []*backend {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	return tis.backends
+}
+
+// add target相同时返回错误
+func (tis *registry) add(b *backend) error {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	for _, cli := range tis.backends {
+		if cli.Target() == b.Target() {
+			return fmt.Errorf("already exists")
+		}
+	}
+
+	backends := make([]*backend, 0, len(tis.backends)+1)
+	tis.backends = append(append(backends, tis.backends...), b)
+	return nil
+}
+
+// remove 按target删除, fn不为nil时只删除fn返回true的
+func (tis *registry) remove(target string, fn func(b *backend) bool) (*backend, bool) {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	for i, cli := range tis.backends {
+		if cli.Target() == target && (fn == nil || fn(cli)) {
+			backends := make([]*backend, 0, len(tis.backends)-1)
+			tis.backends = append(append(backends, tis.backends[:i]...), tis.backends[i+1:]...)
+			return cli, true
+		}
+	}
+
+	return nil, false
+}
+
+// removeAll 删除全部服务
+func (tis *registry) removeAll() []*backend {
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
+
+	backends := tis.backends
+	tis.backends = nil
+	return backends
+}
+
+// whileRegistered b仍未删除时在锁内执行fn, 与remove互斥, 删除后不会再执行
+func (tis *registry) whileRegistered(b *backend, fn func()) bool {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
+	for _, cli := range tis.backends {
+		if cli == b {
+			fn()
+			return true
+		}
+	}
+
+	return false
+}
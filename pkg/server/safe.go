@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/stub"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DefaultSafeMethods 只读模式下默认允许的方法
+var DefaultSafeMethods = []string{"Get*", "List*"}
+
+// confirmTTL 确认token有效期
+const confirmTTL = time.Minute * 5
+
+// ConfirmRequiredError 只读服务的非安全方法, 使用Token再次调用
+type ConfirmRequiredError struct {
+	Target  string
+	Service string
+	Method  string
+	Token   string // 为空时不支持确认, 如gateway和场景脚本
+}
+
+func (tis *ConfirmRequiredError) Error() string {
+	return fmt.Sprintf("%v is read-only, %v/%v may have side effects and requires confirmation", tis.Target, tis.Service, tis.Method)
+}
+
+type confirmation struct {
+	key     string
+	expires time.Time
+}
+
+// isSafe 方法名匹配safe_methods或 idempotency_level = NO_SIDE_EFFECTS
+func (tis *backend) isSafe(service, method string) bool {
+	if !tis.config.ReadOnly {
+		return true
+	}
+
+	patterns := tis.config.SafeMethods
+	if len(patterns) == 0 {
+		patterns = DefaultSafeMethods
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+
+	if mtd, ok := tis.FindMethodDescriptor(service, method); ok {
+		return mtd.GetMethodOptions().GetIdempotencyLevel() == descriptorpb.MethodOptions_NO_SIDE_EFFECTS
+	}
+
+	return false
+}
+
+// checkSafe 只读服务的非安全方法需要确认, confirm为上次返回的token, 使用后失效
+// allowConfirm为false时直接拒绝
+func (tis *HttpServer) checkSafe(cli *backend, service, method, confirm string, allowConfirm bool) error {
+	if cli.isSafe(service, method) {
+		return nil
+	}
+
+	target := cli.Target()
+	e := &ConfirmRequiredError{Target: target, Service: service, Method: method}
+	if !allowConfirm {
+		return e
+	}
+
+	key := target + "/" + service + "/" + method
+
+	tis.confirmsMux.Lock()
+	defer tis.confirmsMux.Unlock()
+
+	now := time.Now()
+	for token, item := range tis.confirms {
+		if now.After(item.expires) {
+			delete(tis.confirms, token)
+		}
+	}
+
+	if item, ok := tis.confirms[confirm]; ok && len(confirm) > 0 && item.key == key {
+		delete(tis.confirms, confirm)
+		return nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	e.Token = hex.EncodeToString(buf)
+	tis.confirms[e.Token] = &confirmation{key: key, expires: now.Add(confirmTTL)}
+
+	return e
+}
+
+// abortConfirm 返回428及确认token
+func abortConfirm(c *gin.Context, err error) {
+	var confirm *ConfirmRequiredError
+	if !errors.As(err, &confirm) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusPreconditionRequired, gin.H{
+		"error":   err.Error(),
+		"confirm": confirm.Token,
+	})
+}
+
+func (tis *HttpServer) findBackend(cli *stub.Stub) (*backend, bool) {
+	for _, b := range tis.clients.list() {
+		if b.Stub == cli {
+			return b, true
+		}
+	}
+
+	return nil, false
+}
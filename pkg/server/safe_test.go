@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/stub"
+)
+
+// TestCheckSafe 只读服务的确认token: 只能使用一次, 过期失效, 只对同一服务的同一方法有效
+func TestCheckSafe(t *testing.T) {
+	srv := &HttpServer{confirms: map[string]*confirmation{}}
+	cli := &backend{
+		Stub:   stub.NewStub("127.0.0.1", 50051),
+		config: config.Service{ReadOnly: true, SafeMethods: []string{"Find*"}},
+	}
+	other := &backend{
+		Stub:   stub.NewStub("127.0.0.1", 50052),
+		config: config.Service{ReadOnly: true},
+	}
+
+	// issue 返回DeleteUser的确认token
+	issue := func(t *testing.T) string {
+		var e *ConfirmRequiredError
+		if err := srv.checkSafe(cli, "user.UserService", "DeleteUser", "", true); !errors.As(err, &e) || len(e.Token) == 0 {
+			t.Fatalf("want confirm token, got %v", err)
+		}
+		return e.Token
+	}
+
+	tests := []struct {
+		name   string
+		cli    *backend
+		method string
+		token  func(t *testing.T) string
+		allow  bool // allowConfirm
+		ok     bool
+	}{
+		{"safe method", cli, "FindUser", func(t *testing.T) string { return "" }, true, true},
+		{"writable backend", &backend{Stub: cli.Stub}, "DeleteUser", func(t *testing.T) string { return "" }, true, true},
+		{"no token", cli, "DeleteUser", func(t *testing.T) string { return "" }, true, false},
+		{"issued token", cli, "DeleteUser", issue, true, true},
+		{"reused token", cli, "DeleteUser", func(t *testing.T) string {
+			token := issue(t)
+			if err := srv.checkSafe(cli, "user.UserService", "DeleteUser", token, true); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}, true, false},
+		{"expired token", cli, "DeleteUser", func(t *testing.T) string {
+			token := issue(t)
+			srv.confirms[token].expires = time.Now().Add(-time.Second)
+			return token
+		}, true, false},
+		{"other method", cli, "UpdateUser", issue, true, false},
+		{"other backend", other, "DeleteUser", issue, true, false},
+		{"confirm not allowed", cli, "DeleteUser", issue, false, false},
+		{"unknown token", cli, "DeleteUser", func(t *testing.T) string { return "0123" }, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := srv.checkSafe(tt.cli, "user.UserService", tt.method, tt.token(t), tt.allow)
+			if (err == nil) != tt.ok {
+				t.Fatalf("want ok %v, got %v", tt.ok, err)
+			}
+
+			var e *ConfirmRequiredError
+			if err != nil && (!errors.As(err, &e) || (len(e.Token) > 0) != tt.allow) {
+				t.Fatalf("error %v", err)
+			}
+		})
+	}
+}
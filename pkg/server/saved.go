@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/general252/grpc_invoke/pkg/scenario"
+	"github.com/general252/grpc_invoke/pkg/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// schemas 查找method回复的schema
+func (tis *HttpServer) schemas(service, method string) (*schema.JsonSchema, bool) {
+	for _, cli := range tis.clients.list() {
+		if objectMethod, ok := cli.GetServerInfo().GetMethod(service, method); ok {
+			return objectMethod.GetResponseJsonSchema(), true
+		}
+	}
+
+	return nil, false
+}
+
+func (tis *HttpServer) routerSavedRequests(c *gin.Context) {
+	c.JSON(http.StatusOK, tis.getCollection().List())
+}
+
+func (tis *HttpServer) routerSaveRequest(c *gin.Context) {
+	var request scenario.Step
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tis.getCollection().Put(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (tis *HttpServer) routerDeleteSavedRequest(c *gin.Context) {
+	if ok, err := tis.getCollection().Delete(c.Param("Name")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// routerRunSavedRequests 执行保存的请求及断言, name可重复指定, format=junit 时返回JUnit报告
+func (tis *HttpServer) routerRunSavedRequests(c *gin.Context) {
+	s := tis.getCollection().Scenario(c.QueryArray("name")...)
+	c.Set(auditedKey, true)
+	report := scenario.Run(c.Request.Context(), s, tis.invoker(c.Query("target")), tis.schemas)
+
+	if c.Query("format") == "junit" {
+		data, err := scenario.JUnit(report)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.Data(http.StatusOK, "application/xml", data)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
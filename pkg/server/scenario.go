@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/general252/grpc_invoke/pkg/scenario"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// invoker 按方法查找已注册的服务并调用, target不为空时只使用该后端(id, 名称或target)
+func (tis *HttpServer) invoker(target string) scenario.Invoker {
+	return func(ctx context.Context, service, method string, requestJsonData string, head map[string]string) (string, metadata.MD, metadata.MD, error) {
+		if err := tis.auth.Authorize(ctx, service, method); err != nil {
+			return "", nil, nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		cli, err := tis.selectBackend(target, service, method)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		if err := tis.checkSafe(cli, service, method, "", false); err != nil {
+			return "", nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		start := time.Now()
+		resp, header, trailer, err := cli.InvokeRPC(ctx, service, method, requestJsonData, head)
+		duration := float64(time.Since(start).Microseconds()) / 1000
+		tis.history.Add(&history.Record{
+			Kind:           history.KindGrpc,
+			Time:           start,
+			Target:         cli.Target(),
+			Service:        service,
+			Method:         method,
+			Header:         metadata.New(head),
+			Requests:       []json.RawMessage{json.RawMessage(requestJsonData)},
+			ResponseHeader: header,
+			Responses:      rawMessages(resp),
+			Trailer:        trailer,
+			Code:           int(status.Code(err)),
+			Error:          errorString(err),
+			DurationMs:     duration,
+		})
+
+		// 接口中已设置auditedKey, 每次调用单独记录
+		e := newEvent(ctx, audit.ActionInvoke)
+		e.Target = cli.Target()
+		e.Service = service
+		e.Method = method
+		e.Header = metadata.New(head)
+		e.Request = json.RawMessage(requestJsonData)
+		e.Code = int(status.Code(err))
+		e.Error = errorString(err)
+		e.DurationMs = duration
+		tis.audit.Add(e)
+
+		return resp, header, trailer, err
+	}
+}
+
+// routerScenario 执行场景脚本(json或yaml), format=junit 时返回JUnit报告
+func (tis *HttpServer) routerScenario(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	s, err := scenario.Parse(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.Set(auditedKey, true)
+	report := scenario.Run(c.Request.Context(), s, tis.invoker(s.Target), tis.schemas)
+
+	if c.Query("format") == "junit" {
+		data, err := scenario.JUnit(report)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.Data(http.StatusOK, "application/xml", data)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
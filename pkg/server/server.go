@@ -4,20 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/auth"
 	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/gateway"
+	"github.com/general252/grpc_invoke/pkg/history"
 	"github.com/general252/grpc_invoke/pkg/http_swagger"
+	"github.com/general252/grpc_invoke/pkg/mock"
+	"github.com/general252/grpc_invoke/pkg/openapi"
+	"github.com/general252/grpc_invoke/pkg/redact"
+	"github.com/general252/grpc_invoke/pkg/scenario"
 	"github.com/general252/grpc_invoke/pkg/stub"
 	"github.com/general252/grpc_invoke/static"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"io"
-	"io/fs"
 	"log"
 	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,35 +34,155 @@ import (
 )
 
 type HttpServer struct {
-	lis *net.TCPListener
+	lis net.Listener
 	r   *gin.Engine
 
-	clients    []*stub.Stub
-	clientsMux sync.Mutex
+	clients registry
 
-	apis []*http_swagger.JsonAPI
+	confirms    map[string]*confirmation // 只读服务的确认token
+	confirmsMux sync.Mutex
+
+	apis    []*http_swagger.JsonAPI
+	apisMux sync.RWMutex
+	watched watchState
+	done    chan struct{}
+
+	mocks    map[string]*mock.Server
+	mocksMux sync.Mutex
+
+	proxies    map[string]*GrpcProxy
+	proxiesMux sync.Mutex
+
+	httpProxies    map[string]*HttpProxy
+	httpProxiesMux sync.Mutex
+
+	history *history.Store
+
+	collection    *scenario.Collection
+	collectionMux sync.RWMutex
+
+	gateway *gateway.Gateway
+
+	auth  *auth.Authenticator
+	audit *audit.Logger
+
+	redactor       *redact.Redactor
+	redactResponse bool
+	redactMux      sync.RWMutex
 }
 
 func NewHttpServer() *HttpServer {
-	return &HttpServer{
-		clients: []*stub.Stub{},
+	collection, err := scenario.LoadCollection(config.WorkspacePath("requests.json"))
+	if err != nil {
+		log.Println(err)
+	}
+
+	tis := &HttpServer{
+		confirms:    map[string]*confirmation{},
+		mocks:       map[string]*mock.Server{},
+		proxies:     map[string]*GrpcProxy{},
+		httpProxies: map[string]*HttpProxy{},
+		history:     history.NewStore(config.WorkspacePath("history.jsonl"), 1000),
+		collection:  collection,
+		gateway:     gateway.New(),
+		auth:        auth.New(),
+		audit:       audit.NewLogger(filepath.Join(config.WorkspaceRoot(), "audit.jsonl")),
+		watched:     watchState{swagger: map[string]*watchFile{}, imports: map[string]*swaggerImport{}},
+		done:        make(chan struct{}),
 	}
+	tis.gateway.Authorize = func(r *http.Request, cli *stub.Stub, service, method string) error {
+		if err := tis.auth.Authorize(r.Context(), service, method); err != nil {
+			return err
+		}
+		if b, ok := tis.findBackend(cli); ok {
+			if err := tis.checkSafe(b, service, method, "", false); err != nil {
+				return status.Error(codes.FailedPrecondition, err.Error())
+			}
+		}
+		return nil
+	}
+	tis.gateway.ForwardAuthorization = func(r *http.Request, cli *stub.Stub) bool {
+		// 启用认证时Authorization是本工具的凭证
+		if !tis.auth.Enabled() {
+			return true
+		}
+		b, ok := tis.findBackend(cli)
+		return ok && b.config.PassAuthorization
+	}
+	tis.updateRedact(nil, nil)
+	tis.history.Redact = tis.redactRecord
+	tis.gateway.OnInvoke = func(r *http.Request, call *gateway.Call) {
+		e := newEvent(r.Context(), audit.ActionInvoke)
+		e.Target = call.Target
+		e.Service = call.Service
+		e.Method = call.Method
+		e.Header = r.Header.Clone()
+		e.Request = call.Request
+		e.Code = int(status.Code(call.Err))
+		e.Error = errorString(call.Err)
+		e.DurationMs = float64(call.Duration.Microseconds()) / 1000
+		tis.audit.Add(e)
+	}
+	tis.loadImports()
+
+	return tis
 }
 
 func (tis *HttpServer) Server(port int) error {
-	tis.r = gin.Default()
-	tis.router()
+	if err := tis.Listen(fmt.Sprintf(":%v", port)); err != nil {
+		return err
+	}
+
+	return tis.Serve()
+}
+
+// Listen 监听地址, 支持 :8888, 127.0.0.1:8888, [::1]:8888, unix:///tmp/grpc_invoke.sock
+func (tis *HttpServer) Listen(address string) error {
+	network, addr := ParseListenAddress(address)
+	if network == "unix" {
+		// 删除上次遗留的socket文件
+		if info, err := os.Stat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(addr)
+		}
+	}
 
-	l, err := net.ListenTCP("tcp4", &net.TCPAddr{Port: port})
+	l, err := net.Listen(network, addr)
 	if err != nil {
 		return err
 	}
 
 	tis.lis = l
+	return nil
+}
+
+// ParseListenAddress 返回network和地址, 只有端口时监听全部地址
+func ParseListenAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//")
+	}
+	if _, err := strconv.Atoi(address); err == nil {
+		return "tcp", ":" + address
+	}
+
+	return "tcp", address
+}
+
+// Serve 在Listen的地址上提供服务, 直到Close
+func (tis *HttpServer) Serve() error {
+	tis.r = gin.New()
+	if logLevel == LogLevelDebug || logLevel == LogLevelInfo {
+		tis.r.Use(tis.requestLogger())
+	}
+	tis.r.Use(gin.Recovery())
+	tis.r.Use(tis.auditMiddleware)
+	tis.r.Use(tis.authMiddleware)
+	tis.r.UseRawPath = true // swagger的ServiceName为url编码的地址
+	tis.router()
 
 	tis.loadSwaggerFile()
+	go tis.watch()
 
-	if err = tis.r.RunListener(l); err != nil {
+	if err := tis.r.RunListener(tis.lis); err != nil {
 		log.Println(err)
 		return err
 	}
@@ -62,6 +190,15 @@ func (tis *HttpServer) Server(port int) error {
 	return nil
 }
 
+// Addr 监听的地址
+func (tis *HttpServer) Addr() net.Addr {
+	if tis.lis == nil {
+		return nil
+	}
+
+	return tis.lis.Addr()
+}
+
 func (tis *HttpServer) Port() int {
 	if tis.lis == nil {
 		return 0
@@ -75,32 +212,74 @@ func (tis *HttpServer) Port() int {
 }
 
 func (tis *HttpServer) Close() {
-	_ = tis.lis.Close()
+	if tis.lis != nil {
+		_ = tis.lis.Close()
+	}
+	close(tis.done)
+	tis.audit.Close()
+
+	for _, cli := range tis.clients.removeAll() {
+		cli.close()
+	}
+
+	tis.mocksMux.Lock()
+	for _, srv := range tis.mocks {
+		srv.Close()
+	}
+	tis.mocksMux.Unlock()
+
+	tis.proxiesMux.Lock()
+	for _, proxy := range tis.proxies {
+		proxy.Close()
+	}
+	tis.proxiesMux.Unlock()
 }
 
-func (tis *HttpServer) AddService(name string, host string, port int) error {
-	tis.clientsMux.Lock()
-	defer tis.clientsMux.Unlock()
+// AddService 添加服务后立即返回, 在后台连接和反射
+func (tis *HttpServer) AddService(service config.Service) error {
+	return tis.addService(service, false)
+}
 
-	for _, cli := range tis.clients {
-		if cli.Host() == host && cli.Port() == port {
-			return fmt.Errorf("already exists")
-		}
+func (tis *HttpServer) addService(service config.Service, fromConfig bool) error {
+	if err := service.Validate(); err != nil {
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
-	defer cancel()
+	b, err := newBackend(service)
+	if err != nil {
+		return err
+	}
+	b.fromConfig = fromConfig
 
-	cli := stub.NewStub(host, port)
-	if err := cli.Connect(ctx); err != nil {
-		log.Printf("connect [%v] [%v:%v] %v", name, host, port, err)
+	if err = tis.clients.add(b); err != nil {
+		b.close()
 		return err
 	}
 
-	tis.clients = append(tis.clients, cli)
+	go tis.runBackend(b)
 	return nil
 }
 
+// RemoveService 删除服务并关闭连接
+// target 为添加时的target或 host:port
+func (tis *HttpServer) RemoveService(target string) bool {
+	return tis.removeService(target, nil)
+}
+
+// removeService fn不为nil时只删除fn返回true的服务
+func (tis *HttpServer) removeService(target string, fn func(b *backend) bool) bool {
+	cli, ok := tis.clients.remove(target, fn)
+	if !ok {
+		return false
+	}
+
+	// 删除后runBackend不会再注册路由
+	tis.gateway.Unregister(cli.Stub)
+	tis.closeProxies(cli.Stub)
+	cli.close()
+	return true
+}
+
 func (tis *HttpServer) router() {
 	api := tis.r.Group("/rpc")
 
@@ -109,24 +288,60 @@ func (tis *HttpServer) router() {
 	})
 
 	api.StaticFS("/ui", static.GetFileSystem()) // 静态文件
+	api.POST("/login", tis.routerLogin)         // 登录, 返回session
+	api.POST("/logout", tis.routerLogout)       // 退出登录
+	api.GET("/me", tis.routerMe)                // 当前用户
 	api.POST("/services", tis.routerAddService)
+	api.DELETE("/services", tis.routerRemoveService)                            // 删除service, 查询参数target或host, port
 	api.GET("/services", tis.routerServices)                                    // 获取service列表
+	api.GET("/backends", tis.routerBackends)                                    // 已添加的服务及连接状态
+	api.GET("/audit", tis.routerAudit)                                          // 查询审计日志
+	api.GET("/openapi.json", tis.routerOpenAPI)                                 // service列表的OpenAPI文档
+	api.GET("/files", tis.routerWatchFiles)                                     // 配置和swagger文件的加载状态
+	api.GET("/workspaces", tis.routerWorkspaces)                                // 工作区列表
+	api.POST("/workspaces", tis.routerSwitchWorkspace)                          // 切换工作区
 	api.GET("/jsonSchema/:ServiceName/:MethodName", tis.routerMethodJsonSchema) // 获取method的Schema
 	api.POST("/invoke/:ServiceName/:MethodName", tis.routerInvoke)              // 调用method
+	api.POST("/bench/:ServiceName/:MethodName", tis.routerBench)                // 压测method
+	api.POST("/compare/:ServiceName/:MethodName", tis.routerCompare)            // 同时调用多个后端并比较回复
+	api.POST("/scenario", tis.routerScenario)                                   // 执行场景脚本
+	api.GET("/requests", tis.routerSavedRequests)                               // 保存的请求
+	api.POST("/requests", tis.routerSaveRequest)                                // 保存请求及断言
+	api.DELETE("/requests/:Name", tis.routerDeleteSavedRequest)                 // 删除保存的请求
+	api.POST("/requests/run", tis.routerRunSavedRequests)                       // 执行保存的请求及断言
+
+	api.POST("/mocks", tis.routerAddMock)                                   // 启动模拟服务
+	api.GET("/mocks", tis.routerMocks)                                      // 模拟服务列表
+	api.PUT("/mocks/:Name/:ServiceName/:MethodName", tis.routerSetMockRule) // 设置method的模拟规则
+	api.DELETE("/mocks/:Name", tis.routerDeleteMock)                        // 停止模拟服务
+
+	api.POST("/proxies", tis.routerAddProxy)                // 启动录制代理
+	api.GET("/proxies", tis.routerProxies)                  // 代理列表
+	api.DELETE("/proxies/:Name", tis.routerDeleteProxy)     // 停止代理
+	api.GET("/history", tis.routerHistory)                  // 调用历史
+	api.DELETE("/history", tis.routerClearHistory)          // 清空历史
+	api.GET("/history/sessions", tis.routerHistorySessions) // 录制会话列表
+	api.POST("/history/replay", tis.routerReplay)           // 回放录制的会话
 
 	swaggerApi := tis.r.Group("/swagger")
 	swaggerApi.GET("/services", tis.swServices)
 	swaggerApi.GET("/jsonSchema/:ServiceName/:MethodName", tis.swServicesJsonSchema)
 	swaggerApi.POST("/invoke/:ServiceName/:MethodName", tis.swRouterInvoke)
-
-	tis.r.Any("/http/*ProxyPath", tis.httpProxy)
+	swaggerApi.POST("/imports", tis.routerImportSwagger)               // 从url导入, 定时重新获取
+	swaggerApi.POST("/imports/upload", tis.routerUploadSwagger)        // 上传文档导入
+	swaggerApi.GET("/imports", tis.routerSwaggerImports)               // 导入的文档
+	swaggerApi.DELETE("/imports/:Name", tis.routerDeleteSwaggerImport) // 删除导入的文档
+
+	api.POST("/http_proxies", tis.routerAddHttpProxy)            // 添加http代理路由, 只在运行期间有效, 持久化需写入配置文件
+	api.GET("/http_proxies", tis.routerHttpProxies)              // http代理路由列表
+	api.DELETE("/http_proxies/:Name", tis.routerDeleteHttpProxy) // 删除运行时添加的http代理路由
+	tis.r.Any("/http/*ProxyPath", tis.httpProxy)                 // 按前缀转发http请求
+
+	api.GET("/gateway/routes", tis.routerGatewayRoutes) // google.api.http 注解生成的路由
+	tis.r.Any("/gw/*Path", tis.routerGateway)           // REST 转 gRPC
 }
 
-type JsonAddServiceRequest struct {
-	Name string `json:"name"`
-	Host string `json:"host"`
-	Port int    `json:"port"`
-}
+type JsonAddServiceRequest = config.Service
 
 func (tis *HttpServer) routerAddService(c *gin.Context) {
 	var request JsonAddServiceRequest
@@ -137,7 +352,19 @@ func (tis *HttpServer) routerAddService(c *gin.Context) {
 		return
 	}
 
-	if err := tis.AddService(request.Name, request.Host, request.Port); err != nil {
+	err := tis.AddService(request)
+
+	e := newEvent(c.Request.Context(), audit.ActionServiceAdd)
+	e.Target = request.Address()
+	e.Service = request.Name
+	e.Error = errorString(err)
+	e.Code = http.StatusOK
+	if err != nil {
+		e.Code = http.StatusBadRequest
+	}
+	tis.addEvent(c, e)
+
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
@@ -147,47 +374,113 @@ func (tis *HttpServer) routerAddService(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{})
 }
 
+func (tis *HttpServer) routerRemoveService(c *gin.Context) {
+	target := c.Query("target")
+	if len(target) == 0 {
+		port, err := strconv.Atoi(c.Query("port"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		target = fmt.Sprintf("%v:%v", c.Query("host"), port)
+	}
+
+	ok := tis.RemoveService(target)
+
+	e := newEvent(c.Request.Context(), audit.ActionServiceRemove)
+	e.Target = target
+	e.Code = http.StatusOK
+	if !ok {
+		e.Code = http.StatusNotFound
+	}
+	tis.addEvent(c, e)
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// JsonBackendService 服务及提供该服务的后端, 同名服务注册多次时使用backend区分
+type JsonBackendService struct {
+	*stub.JsonService
+	Backend     string `json:"backend"` // 后端id
+	BackendName string `json:"backend_name,omitempty"`
+	Target      string `json:"target"`
+}
+
 func (tis *HttpServer) routerServices(c *gin.Context) {
-	clients := tis.clients
+	clients := tis.clients.list()
 
-	var response []*stub.JsonService
+	var response []*JsonBackendService
 	for _, cli := range clients {
-		response = append(response, cli.GetServerInfo().Services...)
+		for _, service := range cli.GetServerInfo().Services {
+			response = append(response, &JsonBackendService{
+				JsonService: service,
+				Backend:     cli.id,
+				BackendName: cli.config.Name,
+				Target:      cli.Target(),
+			})
+		}
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+func (tis *HttpServer) routerOpenAPI(c *gin.Context) {
+	clients := tis.clients.list()
+
+	// 多个后端提供同名服务时只使用第一个后端的
+	var services []*stub.JsonService
+	seen := map[string]bool{}
+	for _, cli := range clients {
+		for _, service := range cli.GetServerInfo().Services {
+			if !seen[service.Name] {
+				seen[service.Name] = true
+				services = append(services, service)
+			}
+		}
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	c.JSON(http.StatusOK, openapi.Generate(services, fmt.Sprintf("%v://%v", scheme, c.Request.Host)))
+}
+
 func (tis *HttpServer) routerMethodJsonSchema(c *gin.Context) {
 	serviceName := c.Param("ServiceName")
 	methodName := c.Param("MethodName")
 
-	clients := tis.clients
-
 	log.Println(serviceName)
 	log.Println(methodName)
 
-	for _, cli := range clients {
-		if objectMethod, ok := cli.GetServerInfo().GetMethod(serviceName, methodName); ok {
-			inSchema := objectMethod.GetRequestJsonSchema()
-			outSchema := objectMethod.GetResponseJsonSchema()
-
-			c.JSON(http.StatusOK, gin.H{
-				"input":  inSchema,
-				"output": outSchema,
-			})
-			return
-		}
+	cli, err := tis.selectBackend(c.Query("backend"), serviceName, methodName)
+	if err != nil {
+		abortSelect(c, err)
+		return
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{
-		"error": "not found",
+	objectMethod, _ := cli.GetServerInfo().GetMethod(serviceName, methodName)
+	c.JSON(http.StatusOK, gin.H{
+		"input":  objectMethod.GetRequestJsonSchema(),
+		"output": objectMethod.GetResponseJsonSchema(),
 	})
 }
 
 type JsonInvokeRequest struct {
-	Header map[string]string `json:"header"`
-	Data   json.RawMessage   `json:"data"`
+	Header  map[string]string `json:"header"`
+	Data    json.RawMessage   `json:"data"`
+	Confirm string            `json:"confirm,omitempty"` // 只读服务的非安全方法, 使用上次返回的确认token
+	Backend string            `json:"backend,omitempty"` // 后端id, 名称或target, 为空时使用第一个有该方法的后端
 }
 
 type JsonInvokeReply struct {
@@ -200,8 +493,6 @@ func (tis *HttpServer) routerInvoke(c *gin.Context) {
 	serviceName := c.Param("ServiceName")
 	methodName := c.Param("MethodName")
 
-	clients := tis.clients
-
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -224,30 +515,86 @@ func (tis *HttpServer) routerInvoke(c *gin.Context) {
 		return
 	}
 
-	for _, cli := range clients {
-		if _, ok := cli.GetServerInfo().GetMethod(serviceName, methodName); ok {
-			// 执行
-			if resp, header, trailer, err := cli.InvokeRPC(c.Request.Context(), serviceName, methodName, string(body), objectRequest.Header); err != nil {
-				log.Println(err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": err.Error(),
-				})
-			} else {
-				// 回复
-				var object map[string]any
-				_ = json.Unmarshal([]byte(resp), &object)
-				c.JSON(http.StatusOK, &JsonInvokeReply{
-					Header:  header,
-					Trailer: trailer,
-					Data:    object,
-				})
-			}
+	if err = tis.auth.Authorize(c.Request.Context(), serviceName, methodName); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-			return
-		}
+	cli, err := tis.selectBackend(objectRequest.Backend, serviceName, methodName)
+	if err != nil {
+		abortSelect(c, err)
+		return
+	}
+
+	if err = tis.checkSafe(cli, serviceName, methodName, objectRequest.Confirm, true); err != nil {
+		abortConfirm(c, err)
+		return
+	}
+
+	// 执行
+	start := time.Now()
+	resp, header, trailer, err := cli.InvokeRPC(c.Request.Context(), serviceName, methodName, string(body), objectRequest.Header)
+	tis.history.Add(&history.Record{
+		Kind:           history.KindGrpc,
+		Time:           start,
+		Target:         cli.Target(),
+		Service:        serviceName,
+		Method:         methodName,
+		Header:         metadata.New(objectRequest.Header),
+		Requests:       []json.RawMessage{body},
+		ResponseHeader: header,
+		Responses:      rawMessages(resp),
+		Trailer:        trailer,
+		Code:           int(status.Code(err)),
+		Error:          errorString(err),
+		DurationMs:     float64(time.Since(start).Microseconds()) / 1000,
+	})
+
+	e := newEvent(c.Request.Context(), audit.ActionInvoke)
+	e.Target = cli.Target()
+	e.Service = serviceName
+	e.Method = methodName
+	e.Header = metadata.New(objectRequest.Header)
+	e.Request = body
+	e.Code = int(status.Code(err))
+	e.Error = errorString(err)
+	e.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	tis.addEvent(c, e)
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	} else {
+		// 回复
+		data, replyHeader, replyTrailer := tis.redactReply(serviceName, methodName, []byte(resp), header, trailer)
+		var object map[string]any
+		_ = json.Unmarshal(data, &object)
+		c.JSON(http.StatusOK, &JsonInvokeReply{
+			Header:  replyHeader,
+			Trailer: replyTrailer,
+			Data:    object,
+		})
+	}
+}
+
+func rawMessages(data string) []json.RawMessage {
+	if len(data) == 0 {
+		return nil
 	}
 
-	c.JSON(http.StatusNotFound, gin.H{})
+	return []json.RawMessage{json.RawMessage(data)}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return status.Convert(err).Message()
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -264,7 +611,7 @@ type JsonSwaggerServiceMethod struct {
 
 func (tis *HttpServer) swServices(c *gin.Context) {
 	var response []*JsonSwaggerService
-	for _, api := range tis.apis {
+	for _, api := range tis.getApis() {
 		item := &JsonSwaggerService{
 			Name:    api.String(),
 			Methods: []*JsonSwaggerServiceMethod{},
@@ -283,26 +630,30 @@ func (tis *HttpServer) swServices(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// swServicesJsonSchema MethodName为路径, 同一路径有多个操作时使用查询参数method指定http方法
 func (tis *HttpServer) swServicesJsonSchema(c *gin.Context) {
 	serviceName := c.Param("ServiceName")
 	methodName := c.Param("MethodName")
 
-	for _, api := range tis.apis {
-		if api.String() == serviceName {
-			for _, method := range api.Methods {
-				if method.Path == methodName {
-					var objectInput map[string]any
-					_ = json.Unmarshal([]byte(method.Input), &objectInput)
-
-					var objectOutput map[string]any
-					_ = json.Unmarshal([]byte(method.Output), &objectOutput)
-
-					c.JSON(http.StatusOK, gin.H{
-						"input":  objectInput,
-						"output": objectOutput,
-					})
-				}
-			}
+	for _, api := range tis.getApis() {
+		if api.String() != serviceName {
+			continue
+		}
+
+		if method, ok := api.GetMethod(methodName, c.Query("method")); ok {
+			var objectInput map[string]any
+			_ = json.Unmarshal([]byte(method.Input), &objectInput)
+
+			var objectOutput map[string]any
+			_ = json.Unmarshal([]byte(method.Output), &objectOutput)
+
+			c.JSON(http.StatusOK, gin.H{
+				"method":     method.Method,
+				"parameters": method.Parameters,
+				"input":      objectInput,
+				"output":     objectOutput,
+			})
+			return
 		}
 	}
 
@@ -311,38 +662,96 @@ func (tis *HttpServer) swServicesJsonSchema(c *gin.Context) {
 	})
 }
 
-// swRouterInvoke 废除, 使用代理的方式解决http调用
+type JsonSwaggerInvokeReply struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Trailer http.Header `json:"trailer"`
+	Data    any         `json:"data"` // json回复解析为对象, 否则为字符串
+}
+
+// maxInvokeReply 调用swagger接口时回复body最大长度
+const maxInvokeReply = 1 << 20
+
+// swRouterInvoke 调用swagger定义的http接口
+// ServiceName为String()的url编码, MethodName为路径, 同一路径有多个操作时使用查询参数method指定http方法
 func (tis *HttpServer) swRouterInvoke(c *gin.Context) {
 	serviceName := c.Param("ServiceName")
 	methodName := c.Param("MethodName")
 
+	var objectRequest http_swagger.InvokeRequest
+	if err := c.ShouldBindJSON(&objectRequest); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	var objectMethod *http_swagger.JsonMethod
 	var objectAPI *http_swagger.JsonAPI
-	for _, api := range tis.apis {
-		if api.String() == serviceName {
-			for _, method := range api.Methods {
-				if method.Path == methodName {
-					objectMethod = &method
-					objectAPI = api
-				}
-			}
+	for _, api := range tis.getApis() {
+		if api.String() != serviceName {
+			continue
+		}
+		if method, ok := api.GetMethod(methodName, c.Query("method")); ok {
+			objectMethod = method
+			objectAPI = api
+			break
 		}
 	}
+	if objectMethod == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	if err := tis.auth.Authorize(c.Request.Context(), objectAPI.String(), objectMethod.Method+" "+objectMethod.Path); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second*30)
 	defer cancel()
 
-	uri := fmt.Sprintf("%v/%v", objectAPI.String(), objectMethod.Path)
-	req, err := http.NewRequestWithContext(ctx, objectMethod.Method, uri, c.Request.Body)
+	req, err := objectAPI.NewRequest(ctx, objectMethod, &objectRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("new request fail. %v", err),
 		})
 		return
 	}
 
+	start := time.Now()
+	record := &history.Record{
+		Kind:     history.KindHttp,
+		Time:     start,
+		Target:   objectAPI.String(),
+		Service:  objectAPI.String(),
+		Method:   fmt.Sprintf("%v %v", objectMethod.Method, objectMethod.Path),
+		Header:   req.Header.Clone(),
+		Requests: rawMessages(string(objectRequest.Data)),
+	}
+	defer func() {
+		record.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		tis.history.Add(record)
+
+		e := newEvent(c.Request.Context(), audit.ActionInvoke)
+		e.Target = req.URL.String()
+		e.Service = record.Service
+		e.Method = record.Method
+		e.Header = record.Header
+		e.Request = objectRequest.Data
+		e.Code = record.Code
+		e.Error = record.Error
+		e.DurationMs = record.DurationMs
+		tis.addEvent(c, e)
+	}()
+
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
+		record.Error = err.Error()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("get response fail. %v", err),
 		})
@@ -351,73 +760,48 @@ func (tis *HttpServer) swRouterInvoke(c *gin.Context) {
 
 	defer res.Body.Close()
 
-	data, err := io.ReadAll(res.Body)
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxInvokeReply+1))
+	record.Code = res.StatusCode
+	record.ResponseHeader = res.Header
+	record.Trailer = res.Trailer
+	if err == nil && len(data) > maxInvokeReply {
+		err = fmt.Errorf("body exceeds %v bytes", maxInvokeReply)
+	}
 	if err != nil {
+		record.Error = err.Error()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("read response fail. %v", err),
 		})
 		return
 	}
 
-	var objectOutput map[string]any
-	_ = json.Unmarshal(data, &objectOutput)
-
-	c.JSON(http.StatusOK, data)
-}
-
-func (tis *HttpServer) loadSwaggerFile() {
-	dir, _ := config.GetExeDir()
-	swaggerDir := fmt.Sprintf("%v/swagger", dir)
-
-	var swaggerFiles []string
-	_ = filepath.Walk(swaggerDir, func(path string, info fs.FileInfo, err error) error {
-		if info == nil || info.IsDir() {
-			return nil
-		}
-
-		if !strings.HasSuffix(info.Name(), ".json") {
-			return nil
-		}
+	if json.Valid(data) {
+		record.Responses = rawMessages(string(data))
+	}
 
-		swaggerFiles = append(swaggerFiles, path)
+	data, replyHeader, replyTrailer := tis.redactReply("", "", data, res.Header, res.Trailer)
+	var objectOutput any = string(data)
+	if json.Valid(data) {
+		_ = json.Unmarshal(data, &objectOutput)
+	}
 
-		return nil
+	c.JSON(http.StatusOK, &JsonSwaggerInvokeReply{
+		Status:  res.StatusCode,
+		Header:  replyHeader,
+		Trailer: replyTrailer,
+		Data:    objectOutput,
 	})
+}
 
-	log.Println(swaggerFiles)
-
-	for _, swaggerFile := range swaggerFiles {
-		data, err := os.ReadFile(swaggerFile)
-		if err != nil {
-			continue
-		}
-		api, err := http_swagger.ParseSwagger(data)
-		if err != nil {
-			continue
-		}
-
-		tis.apis = append(tis.apis, api)
-	}
+func (tis *HttpServer) routerGatewayRoutes(c *gin.Context) {
+	c.JSON(http.StatusOK, tis.gateway.Routes())
 }
 
-const ProxyAddr = "http://127.0.0.1:9780"
+func (tis *HttpServer) routerGateway(c *gin.Context) {
+	tis.gateway.Handle(c.Writer, c.Request, c.Param("Path"))
 
-func (tis *HttpServer) httpProxy(c *gin.Context) {
-	remote, err := url.Parse(ProxyAddr)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	// 调用由OnInvoke记录, 被拒绝的访问由auditMiddleware记录
+	if code := c.Writer.Status(); code != http.StatusUnauthorized && code != http.StatusForbidden {
+		c.Set(auditedKey, true)
 	}
-
-	proxy := httputil.NewSingleHostReverseProxy(remote)
-	proxy.Director = func(req *http.Request) {
-		req.Header = c.Request.Header
-		req.Host = remote.Host
-		req.URL.Scheme = remote.Scheme
-		req.URL.Host = remote.Host
-		req.URL.Path = c.Param("ProxyPath")
-	}
-
-	proxy.ServeHTTP(c.Writer, c.Request)
 }
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/examples"
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/history"
+	"github.com/general252/grpc_invoke/pkg/http_swagger"
+	"github.com/gin-gonic/gin"
+)
+
+// TestConcurrentServices 调用的同时添加删除服务, 使用 go test -race 检查数据竞争
+func TestConcurrentServices(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	port, err := examples.RunHelloServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	if err = srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+	base := fmt.Sprintf("http://%v/rpc", srv.Addr())
+
+	if err = srv.AddService(config.Service{Name: "hello", Host: "127.0.0.1", Port: port}); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, srv, "hello")
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// 同一服务的另一个地址, 反复添加和删除
+		target := fmt.Sprintf("passthrough:///127.0.0.1:%v", port)
+		for i := 0; i < 20; i++ {
+			if err := srv.AddService(config.Service{Name: "extra", Target: target}); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+			if !srv.RemoveService(target) {
+				t.Errorf("remove %v: not found", target)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				code, body := request(http.MethodPost, base+"/invoke/helloworld.Greeter/SayHello", `{"data": {"name": "a"}, "backend": "hello"}`)
+				if code != http.StatusOK || !strings.Contains(body, "hello a") {
+					t.Errorf("invoke: %v %v", code, body)
+					return
+				}
+
+				for _, path := range []string{"/services", "/backends", "/jsonSchema/helloworld.Greeter/SayHello"} {
+					if code, body := request(http.MethodGet, base+path, ""); code != http.StatusOK {
+						t.Errorf("%v: %v %v", path, code, body)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if backends := srv.clients.list(); len(backends) != 1 {
+		t.Errorf("want 1 backend, got %v", len(backends))
+	}
+}
+
+// TestScenarioAudit 场景中的每次调用记录审计日志和历史, 接口本身不再记录
+func TestScenarioAudit(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	port, err := examples.RunHelloServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	if err = srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+	base := fmt.Sprintf("http://%v/rpc", srv.Addr())
+
+	if err = srv.AddService(config.Service{Name: "hello", Host: "127.0.0.1", Port: port}); err != nil {
+		t.Fatal(err)
+	}
+	waitReady(t, srv, "hello")
+
+	script := `{"name": "hello", "steps": [
+		{"name": "a", "service": "helloworld.Greeter", "method": "SayHello", "data": {"name": "a"}},
+		{"name": "b", "service": "helloworld.Greeter", "method": "SayHello", "data": {"name": "b"}}]}`
+	if code, body := request(http.MethodPost, base+"/scenario", script); code != http.StatusOK {
+		t.Fatalf("scenario: %v %v", code, body)
+	}
+
+	events, err := srv.audit.Find(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("want 2 audit events, got %v", len(events))
+	}
+	for _, e := range events {
+		if e.Action != audit.ActionInvoke || e.Method != "SayHello" {
+			t.Errorf("event %+v", e)
+		}
+	}
+
+	if records := srv.history.Find(history.Query{Kind: history.KindGrpc}); len(records) != 2 {
+		t.Errorf("want 2 history records, got %v", len(records))
+	}
+}
+
+// TestSwaggerInvokeLimit 回复body超过1MiB时返回错误
+func TestSwaggerInvokeLimit(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := 16
+		if r.URL.Path == "/large" {
+			size = maxInvokeReply + 1
+		}
+		_, _ = w.Write(bytes.Repeat([]byte("a"), size))
+	}))
+	defer ts.Close()
+
+	api, err := http_swagger.ParseSwagger([]byte(fmt.Sprintf(`{"swagger": "2.0", "host": %q, "paths": {
+		"/small": {"get": {"responses": {"200": {"description": ""}}}},
+		"/large": {"get": {"responses": {"200": {"description": ""}}}}}}`, strings.TrimPrefix(ts.URL, "http://"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	if err = srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+	srv.setImport(&swaggerImport{name: "test", api: api, fetchTime: time.Now()})
+	base := fmt.Sprintf("http://%v/swagger/invoke/%v", srv.Addr(), url.PathEscape(api.String()))
+
+	if code, body := request(http.MethodPost, base+"/"+url.PathEscape("/small"), "{}"); code != http.StatusOK {
+		t.Errorf("small: %v %v", code, body)
+	}
+	if code, body := request(http.MethodPost, base+"/"+url.PathEscape("/large"), "{}"); code != http.StatusInternalServerError || !strings.Contains(body, "exceeds") {
+		t.Errorf("large: %v %.100v", code, body)
+	}
+}
+
+func waitReady(t *testing.T, srv *HttpServer, name string) {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		for _, cli := range srv.clients.list() {
+			if cli.config.Name == name && cli.json().State == BackendReady {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	t.Fatalf("backend %v not ready", name)
+}
+
+func request(method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
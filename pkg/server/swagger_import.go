@@ -0,0 +1,349 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/http_swagger"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultImportInterval url导入的swagger默认重新获取间隔
+const defaultImportInterval = time.Minute * 5
+
+// maxSwaggerSize swagger文档最大长度
+const maxSwaggerSize = 32 << 20
+
+// swaggerImport 通过url或上传导入的swagger文档
+type swaggerImport struct {
+	name      string
+	url       string // 为空时为上传的文件
+	filename  string
+	data      []byte // 上传的文档, 保存到工作区
+	interval  time.Duration
+	fetchTime time.Time // 为零时尚未获取
+	fetching  bool
+	api       *http_swagger.JsonAPI
+	errors    []string
+}
+
+// storedImport 工作区中保存的导入, url导入启动后重新获取
+type storedImport struct {
+	Name     string `json:"name"`
+	URL      string `json:"url,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Interval int    `json:"interval,omitempty"` // 秒
+	Data     []byte `json:"data,omitempty"`
+}
+
+func importsFile() string {
+	return config.WorkspacePath("swagger_imports.json")
+}
+
+type JsonSwaggerImport struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	Interval  int       `json:"interval,omitempty"` // 重新获取间隔(秒)
+	FetchTime time.Time `json:"fetch_time"`
+	Service   string    `json:"service,omitempty"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+type JsonImportSwaggerRequest struct {
+	Name     string `json:"name" binding:"required"`
+	URL      string `json:"url" binding:"required"`
+	Interval int    `json:"interval"` // 重新获取间隔(秒), 默认300, 小于0不重新获取
+}
+
+func fetchSwagger(ctx context.Context, uri string) (*http_swagger.JsonAPI, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %v: %v", uri, res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxSwaggerSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return http_swagger.ParseSwagger(data)
+}
+
+func (tis *swaggerImport) json() *JsonSwaggerImport {
+	item := &JsonSwaggerImport{
+		Name:      tis.name,
+		URL:       tis.url,
+		Filename:  tis.filename,
+		Interval:  int(tis.interval / time.Second),
+		FetchTime: tis.fetchTime,
+		Errors:    tis.errors,
+	}
+	if tis.api != nil {
+		item.Service = tis.api.String()
+	}
+
+	return item
+}
+
+// refreshImports 在后台获取未获取及到期的url导入, 获取失败时保留上次的结果
+func (tis *HttpServer) refreshImports() {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	for _, item := range tis.watched.imports {
+		if len(item.url) == 0 || item.fetching {
+			continue
+		}
+		if !item.fetchTime.IsZero() && (item.interval <= 0 || time.Since(item.fetchTime) < item.interval) {
+			continue
+		}
+
+		item.fetching = true
+		go tis.fetchImport(item)
+	}
+}
+
+// fetchImport 获取一个url导入, 服务关闭时取消
+func (tis *HttpServer) fetchImport(item *swaggerImport) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-tis.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	api, err := fetchSwagger(ctx, item.url)
+
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	item.fetching = false
+	item.fetchTime = time.Now()
+	if err != nil {
+		log.Printf("swagger import [%v] %v", item.name, err)
+		item.errors = []string{err.Error()}
+		return
+	}
+
+	item.api = api
+	item.errors = nil
+	if tis.watched.imports[item.name] == item {
+		tis.updateApis()
+	}
+}
+
+// loadImports 读取工作区中保存的导入, 替换当前的导入
+func (tis *HttpServer) loadImports() {
+	imports := map[string]*swaggerImport{}
+
+	data, err := os.ReadFile(importsFile())
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+
+	var stored []*storedImport
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &stored); err != nil {
+			log.Printf("%v: %v", importsFile(), err)
+		}
+	}
+
+	for _, record := range stored {
+		item := &swaggerImport{
+			name:     record.Name,
+			url:      record.URL,
+			filename: record.Filename,
+			data:     record.Data,
+			interval: time.Duration(record.Interval) * time.Second,
+		}
+		if len(item.url) == 0 {
+			item.fetchTime = time.Now()
+			if item.api, err = http_swagger.ParseSwagger(item.data); err != nil {
+				item.errors = []string{err.Error()}
+			}
+		}
+		imports[item.name] = item
+	}
+
+	tis.watched.mux.Lock()
+	tis.watched.imports = imports
+	tis.updateApis()
+	tis.watched.mux.Unlock()
+
+	tis.refreshImports()
+}
+
+// storeImports 保存导入到工作区, 调用时已持有watched.mux
+func (tis *HttpServer) storeImports() {
+	stored := make([]*storedImport, 0, len(tis.watched.imports))
+	for _, item := range tis.watched.imports {
+		stored = append(stored, &storedImport{
+			Name:     item.name,
+			URL:      item.url,
+			Filename: item.filename,
+			Interval: int(item.interval / time.Second),
+			Data:     item.data,
+		})
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].Name < stored[j].Name
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err == nil {
+		err = os.WriteFile(importsFile(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("swagger imports %v", err)
+	}
+}
+
+// setImport 添加或替换导入的swagger
+func (tis *HttpServer) setImport(item *swaggerImport) {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	tis.watched.imports[item.name] = item
+	tis.updateApis()
+	tis.storeImports()
+}
+
+func (tis *HttpServer) routerImportSwagger(c *gin.Context) {
+	var request JsonImportSwaggerRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	api, err := fetchSwagger(c.Request.Context(), request.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	item := &swaggerImport{
+		name:      request.Name,
+		url:       request.URL,
+		interval:  time.Duration(request.Interval) * time.Second,
+		fetchTime: time.Now(),
+		api:       api,
+	}
+	if request.Interval == 0 {
+		item.interval = defaultImportInterval
+	}
+	tis.setImport(item)
+
+	c.JSON(http.StatusOK, item.json())
+}
+
+// routerUploadSwagger multipart上传, 字段file为文档, name默认为文件名
+func (tis *HttpServer) routerUploadSwagger(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSwaggerSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	api, err := http_swagger.ParseSwagger(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	item := &swaggerImport{
+		name:      c.PostForm("name"),
+		filename:  header.Filename,
+		data:      data,
+		fetchTime: time.Now(),
+		api:       api,
+	}
+	if len(item.name) == 0 {
+		item.name = header.Filename
+	}
+	tis.setImport(item)
+
+	c.JSON(http.StatusOK, item.json())
+}
+
+func (tis *HttpServer) routerSwaggerImports(c *gin.Context) {
+	tis.watched.mux.Lock()
+	var response []*JsonSwaggerImport
+	for _, item := range tis.watched.imports {
+		response = append(response, item.json())
+	}
+	tis.watched.mux.Unlock()
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].Name < response[j].Name
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (tis *HttpServer) routerDeleteSwaggerImport(c *gin.Context) {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	if _, ok := tis.watched.imports[c.Param("Name")]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "not found",
+		})
+		return
+	}
+
+	delete(tis.watched.imports, c.Param("Name"))
+	tis.updateApis()
+	tis.storeImports()
+
+	c.JSON(http.StatusOK, gin.H{})
+}
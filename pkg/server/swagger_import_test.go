@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+const testImportSwagger = `{
+  "swagger": "2.0",
+  "host": "api.example.com",
+  "paths": {"/ping": {"get": {"responses": {"200": {"description": ""}}}}}
+}`
+
+// TestSwaggerImports url导入在后台逐个获取, 导入保存在工作区, 重启后恢复
+func TestSwaggerImports(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	var fetched int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		} else {
+			atomic.AddInt32(&fetched, 1)
+		}
+		_, _ = w.Write([]byte(testImportSwagger))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	srv := NewHttpServer()
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+	base := fmt.Sprintf("http://%v/swagger", srv.Addr())
+
+	body := fmt.Sprintf(`{"name": "fast", "url": "%v/doc", "interval": 1}`, ts.URL)
+	if code, body := request(http.MethodPost, base+"/imports", body); code != http.StatusOK {
+		t.Fatalf("import: %v %v", code, body)
+	}
+	srv.setImport(&swaggerImport{name: "slow", url: ts.URL + "/slow", interval: time.Second})
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("file", "upload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte(testImportSwagger))
+	_ = writer.WriteField("name", "upload")
+	_ = writer.Close()
+	res, err := http.Post(base+"/imports/upload", writer.FormDataContentType(), &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("upload: %v", res.Status)
+	}
+
+	// slow一直未返回, 不影响fast重新获取
+	time.Sleep(time.Second)
+	start := time.Now()
+	srv.refreshImports()
+	if time.Since(start) > time.Millisecond*100 {
+		t.Fatalf("refresh blocked for %v", time.Since(start))
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&fetched) >= 2 })
+
+	// 新的服务从工作区恢复导入, url导入重新获取
+	restored := NewHttpServer()
+	defer restored.Close()
+	waitFor(t, func() bool {
+		restored.watched.mux.Lock()
+		defer restored.watched.mux.Unlock()
+		return !restored.watched.imports["fast"].fetchTime.IsZero()
+	})
+
+	restored.watched.mux.Lock()
+	defer restored.watched.mux.Unlock()
+	if len(restored.watched.imports) != 3 {
+		t.Fatalf("restored %v imports", len(restored.watched.imports))
+	}
+	for _, name := range []string{"fast", "upload"} {
+		if item := restored.watched.imports[name]; item.api == nil || len(item.errors) > 0 {
+			t.Errorf("%v: %+v", name, item.json())
+		}
+	}
+	if item := restored.watched.imports["slow"]; !item.fetching || item.url != ts.URL+"/slow" || item.interval != time.Second {
+		t.Errorf("slow: %+v", item.json())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	t.Fatal("timeout")
+}
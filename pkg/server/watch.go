@@ -0,0 +1,390 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/general252/grpc_invoke/pkg/audit"
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/http_swagger"
+	"github.com/gin-gonic/gin"
+)
+
+// watchInterval 检查swagger目录和配置文件的间隔
+const watchInterval = time.Second * 2
+
+const (
+	WatchKindConfig  = "config"
+	WatchKindSwagger = "swagger"
+	WatchKindImport  = "import"
+)
+
+type JsonWatchFile struct {
+	File    string    `json:"file"`
+	Kind    string    `json:"kind"` // config, swagger
+	ModTime time.Time `json:"mod_time"`
+	Service string    `json:"service,omitempty"` // swagger的地址
+	Errors  []string  `json:"errors,omitempty"`  // 解析错误, 添加服务失败
+}
+
+type watchFile struct {
+	modTime time.Time
+	size    int64
+	api     *http_swagger.JsonAPI
+	errors  []string
+}
+
+func (tis *watchFile) changed(info fs.FileInfo) bool {
+	return tis == nil || !tis.modTime.Equal(info.ModTime()) || tis.size != info.Size()
+}
+
+// watchState 已加载的文件, 以及配置文件中生效的服务和代理
+type watchState struct {
+	swagger  map[string]*watchFile
+	imports  map[string]*swaggerImport
+	config   *watchFile
+	auth     *watchFile // 默认工作区的配置文件
+	services []config.Service
+	proxies  []config.HttpProxy
+	mux      sync.Mutex
+}
+
+func swaggerDir() string {
+	return config.WorkspacePath("swagger")
+}
+
+// watch 定时检查文件修改, Close后退出
+func (tis *HttpServer) watch() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tis.done:
+			return
+		case <-ticker.C:
+			tis.loadSwaggerFile()
+			tis.refreshImports()
+			tis.reloadConfig(false)
+			tis.reloadAuth(false)
+		}
+	}
+}
+
+// loadSwaggerFile 重新解析修改过的swagger文件, 删除已不存在的
+func (tis *HttpServer) loadSwaggerFile() {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	changed := false
+	found := map[string]bool{}
+
+	_ = filepath.Walk(swaggerDir(), func(path string, info fs.FileInfo, err error) error {
+		if info == nil || info.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil
+		}
+
+		found[path] = true
+
+		file := tis.watched.swagger[path]
+		if !file.changed(info) {
+			return nil
+		}
+
+		changed = true
+		file = &watchFile{modTime: info.ModTime(), size: info.Size()}
+		tis.watched.swagger[path] = file
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			file.errors = []string{err.Error()}
+			log.Printf("swagger %v %v", path, err)
+			return nil
+		}
+
+		if file.api, err = http_swagger.ParseSwagger(data); err != nil {
+			file.errors = []string{err.Error()}
+			log.Printf("swagger %v %v", path, err)
+			return nil
+		}
+
+		log.Printf("swagger %v loaded", path)
+		return nil
+	})
+
+	for path := range tis.watched.swagger {
+		if !found[path] {
+			delete(tis.watched.swagger, path)
+			changed = true
+			log.Printf("swagger %v removed", path)
+		}
+	}
+
+	if changed {
+		tis.updateApis()
+	}
+}
+
+// updateApis 目录中的文件按文件名, 导入的按名称, 需持有watched.mux
+func (tis *HttpServer) updateApis() {
+	var apis []*http_swagger.JsonAPI
+
+	var files []string
+	for path := range tis.watched.swagger {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		if api := tis.watched.swagger[path].api; api != nil {
+			apis = append(apis, api)
+		}
+	}
+
+	var names []string
+	for name := range tis.watched.imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if api := tis.watched.imports[name].api; api != nil {
+			apis = append(apis, api)
+		}
+	}
+
+	tis.apisMux.Lock()
+	tis.apis = apis
+	tis.apisMux.Unlock()
+}
+
+func (tis *HttpServer) getApis() []*http_swagger.JsonAPI {
+	tis.apisMux.RLock()
+	defer tis.apisMux.RUnlock()
+
+	return tis.apis
+}
+
+// LoadConfig 加载配置文件中的服务和http代理, 之后配置文件修改时自动更新
+func (tis *HttpServer) LoadConfig() {
+	tis.reloadConfig(true)
+	tis.reloadAuth(true)
+}
+
+func (tis *HttpServer) reloadConfig(force bool) {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	cfg := config.GetConfig()
+
+	info, err := os.Stat(cfg.Filename())
+	if err != nil {
+		if tis.watched.config == nil || len(tis.watched.config.errors) == 0 {
+			log.Println(err)
+		}
+		tis.watched.config = &watchFile{errors: []string{err.Error()}}
+		return
+	}
+
+	if !force && !tis.watched.config.changed(info) {
+		return
+	}
+
+	file := &watchFile{modTime: info.ModTime(), size: info.Size()}
+	tis.watched.config = file
+
+	if err = cfg.Load(); err != nil {
+		log.Printf("config %v %v", cfg.Filename(), err)
+		file.errors = []string{err.Error()}
+		return
+	}
+
+	tis.updateRedact(cfg.Redact, cfg.Audit)
+	file.errors = tis.applyConfig(cfg.Services, cfg.HttpProxies)
+}
+
+// reloadAuth 认证使用默认工作区的配置, 切换到其他工作区时不会关闭或修改认证
+// 配置文件不存在或解析失败时保留原来的认证
+func (tis *HttpServer) reloadAuth(force bool) {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	cfg := config.RootConfig()
+
+	info, err := os.Stat(cfg.Filename())
+	if err != nil {
+		return
+	}
+
+	if !force && !tis.watched.auth.changed(info) {
+		return
+	}
+	tis.watched.auth = &watchFile{modTime: info.ModTime(), size: info.Size()}
+
+	// 在默认工作区时已由reloadConfig加载
+	if cfg != config.GetConfig() {
+		if err = cfg.Load(); err != nil {
+			log.Printf("config %v %v", cfg.Filename(), err)
+			return
+		}
+	}
+
+	tis.auth.Update(cfg.Auth)
+}
+
+// applyConfig 与上次生效的配置比较, 删除移除的, 添加新增的
+// 只记录添加成功的, 失败的在配置文件下次修改时重试, 也不会删除同名的其他来源的服务
+func (tis *HttpServer) applyConfig(services []config.Service, proxies []config.HttpProxy) []string {
+	var errs []string
+
+	for _, old := range tis.watched.services {
+		if !containsService(services, old) {
+			// 只删除由配置文件添加的, 接口添加的同地址服务保留
+			if !tis.removeService(old.Address(), func(b *backend) bool { return b.fromConfig }) {
+				continue
+			}
+			log.Printf("remove service [%v] [%v]", old.Name, old.Address())
+			tis.audit.Add(&audit.Event{
+				User:    audit.UserConfig,
+				Action:  audit.ActionServiceRemove,
+				Target:  old.Address(),
+				Service: old.Name,
+			})
+		}
+	}
+	var added []config.Service
+	for _, service := range services {
+		if containsService(tis.watched.services, service) {
+			added = append(added, service)
+			continue
+		}
+		err := tis.addService(service, true)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("service [%v] %v", service.Name, err))
+		} else {
+			added = append(added, service)
+		}
+		tis.audit.Add(&audit.Event{
+			User:    audit.UserConfig,
+			Action:  audit.ActionServiceAdd,
+			Target:  service.Address(),
+			Service: service.Name,
+			Error:   errorString(err),
+		})
+	}
+	tis.watched.services = added
+
+	for _, old := range tis.watched.proxies {
+		if !containsProxy(proxies, old) {
+			tis.RemoveHttpProxy(old.Name)
+		}
+	}
+	var addedProxies []config.HttpProxy
+	for _, proxy := range proxies {
+		if containsProxy(tis.watched.proxies, proxy) {
+			addedProxies = append(addedProxies, proxy)
+			continue
+		}
+		if err := tis.AddHttpProxy(proxy); err != nil {
+			errs = append(errs, fmt.Sprintf("http proxy [%v] %v", proxy.Name, err))
+			continue
+		}
+		addedProxies = append(addedProxies, proxy)
+	}
+	tis.watched.proxies = addedProxies
+
+	return errs
+}
+
+func containsService(services []config.Service, service config.Service) bool {
+	for _, item := range services {
+		if reflect.DeepEqual(item, service) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsProxy(proxies []config.HttpProxy, proxy config.HttpProxy) bool {
+	for _, item := range proxies {
+		if reflect.DeepEqual(item, proxy) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (tis *HttpServer) routerWatchFiles(c *gin.Context) {
+	tis.watched.mux.Lock()
+	defer tis.watched.mux.Unlock()
+
+	var response []*JsonWatchFile
+	if file := tis.watched.config; file != nil {
+		response = append(response, &JsonWatchFile{
+			File:    config.GetConfig().Filename(),
+			Kind:    WatchKindConfig,
+			ModTime: file.modTime,
+			Errors:  file.errors,
+		})
+	}
+
+	var files []string
+	for path := range tis.watched.swagger {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		file := tis.watched.swagger[path]
+		item := &JsonWatchFile{
+			File:    path,
+			Kind:    WatchKindSwagger,
+			ModTime: file.modTime,
+			Errors:  file.errors,
+		}
+		if file.api != nil {
+			item.Service = file.api.String()
+		}
+		response = append(response, item)
+	}
+
+	var names []string
+	for name := range tis.watched.imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := tis.watched.imports[name].json()
+		file := &JsonWatchFile{
+			File:    item.URL,
+			Kind:    WatchKindImport,
+			ModTime: item.FetchTime,
+			Service: item.Service,
+			Errors:  item.Errors,
+		}
+		if len(file.File) == 0 {
+			file.File = item.Filename
+		}
+		response = append(response, file)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
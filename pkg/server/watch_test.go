@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+)
+
+// TestApplyConfigFailed 添加失败的服务不记录, 配置文件移除时不删除其他来源添加的同一服务
+func TestApplyConfigFailed(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	defer srv.Close()
+
+	service := config.Service{Name: "api", Host: "127.0.0.1", Port: 1}
+	if err := srv.AddService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	fromConfig := config.Service{Name: "config", Host: "127.0.0.1", Port: 1}
+	if errs := srv.applyConfig([]config.Service{fromConfig}, nil); len(errs) != 1 {
+		t.Fatalf("want 1 error, got %v", errs)
+	}
+	if len(srv.watched.services) != 0 {
+		t.Fatalf("failed service recorded %v", srv.watched.services)
+	}
+
+	if errs := srv.applyConfig(nil, nil); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if backends := srv.clients.list(); len(backends) != 1 || backends[0].config.Name != "api" {
+		t.Fatalf("backends %v", backends)
+	}
+}
+
+// TestApplyConfigOwnership 配置文件中的服务通过接口删除后重新添加, 配置文件移除时保留
+func TestApplyConfigOwnership(t *testing.T) {
+	if err := config.SetWorkspaceRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewHttpServer()
+	defer srv.Close()
+
+	service := config.Service{Name: "hello", Host: "127.0.0.1", Port: 1}
+	if errs := srv.applyConfig([]config.Service{service}, nil); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if backends := srv.clients.list(); len(backends) != 1 || !backends[0].json().FromConfig {
+		t.Fatalf("backends %v", backends)
+	}
+
+	if !srv.RemoveService(service.Address()) {
+		t.Fatal("remove failed")
+	}
+	if err := srv.AddService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := srv.applyConfig(nil, nil); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if backends := srv.clients.list(); len(backends) != 1 || backends[0].json().FromConfig {
+		t.Fatalf("backends %v", backends)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/general252/grpc_invoke/pkg/scenario"
+	"github.com/gin-gonic/gin"
+)
+
+type JsonWorkspaces struct {
+	Root       string   `json:"root"`
+	Current    string   `json:"current"`
+	Dir        string   `json:"dir"`
+	Workspaces []string `json:"workspaces"`
+}
+
+type JsonSwitchWorkspaceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (tis *HttpServer) getCollection() *scenario.Collection {
+	tis.collectionMux.RLock()
+	defer tis.collectionMux.RUnlock()
+
+	return tis.collection
+}
+
+// SwitchWorkspace 切换工作区, 重新加载保存的数据, swagger文件, 导入的swagger和配置中的服务
+func (tis *HttpServer) SwitchWorkspace(name string) error {
+	if err := config.SwitchWorkspace(name); err != nil {
+		return err
+	}
+
+	tis.history.Open(config.WorkspacePath("history.jsonl"))
+
+	collection, err := scenario.LoadCollection(config.WorkspacePath("requests.json"))
+	if err != nil {
+		log.Println(err)
+	}
+	tis.collectionMux.Lock()
+	tis.collection = collection
+	tis.collectionMux.Unlock()
+
+	tis.watched.mux.Lock()
+	tis.watched.swagger = map[string]*watchFile{}
+	tis.watched.config = nil
+	tis.updateApis()
+	tis.watched.mux.Unlock()
+
+	tis.loadSwaggerFile()
+	tis.loadImports()
+	tis.reloadConfig(true)
+
+	log.Printf("工作区: %v", config.WorkspaceDir())
+	return nil
+}
+
+func (tis *HttpServer) routerWorkspaces(c *gin.Context) {
+	c.JSON(http.StatusOK, &JsonWorkspaces{
+		Root:       config.WorkspaceRoot(),
+		Current:    config.WorkspaceName(),
+		Dir:        config.WorkspaceDir(),
+		Workspaces: config.Workspaces(),
+	})
+}
+
+func (tis *HttpServer) routerSwitchWorkspace(c *gin.Context) {
+	var request JsonSwitchWorkspaceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := tis.SwitchWorkspace(request.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tis.routerWorkspaces(c)
+}
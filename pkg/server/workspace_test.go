@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// TestSwitchWorkspaceAuth 切换工作区需要admin, 切换后仍使用默认工作区的认证
+func TestSwitchWorkspaceAuth(t *testing.T) {
+	root := t.TempDir()
+	err := os.WriteFile(filepath.Join(root, "config.json"), []byte(`{"auth": {"tokens": [
+		{"name": "admin", "token": "admin-0123456789", "role": "admin"},
+		{"name": "ci", "token": "invoker-0123456789", "role": "invoker"}
+	]}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = config.SetWorkspaceRoot(root); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = config.SwitchWorkspace(config.DefaultWorkspace) }()
+	gin.SetMode(gin.ReleaseMode)
+
+	srv := NewHttpServer()
+	srv.LoadConfig()
+	if err = srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve() }()
+	defer srv.Close()
+	url := fmt.Sprintf("http://%v/rpc/workspaces", srv.Addr())
+
+	if code, body := requestAs("invoker-0123456789", http.MethodPost, url, `{"name": "other"}`); code != http.StatusForbidden {
+		t.Fatalf("invoker switch: %v %v", code, body)
+	}
+	if code, body := requestAs("admin-0123456789", http.MethodPost, url, `{"name": "other"}`); code != http.StatusOK {
+		t.Fatalf("admin switch: %v %v", code, body)
+	}
+	if config.WorkspaceName() != "other" {
+		t.Fatalf("workspace %v", config.WorkspaceName())
+	}
+
+	// 新工作区的配置中没有auth
+	if code, _ := requestAs("", http.MethodGet, url, ""); code != http.StatusUnauthorized {
+		t.Fatalf("want 401 after switch, got %v", code)
+	}
+	if code, body := requestAs("invoker-0123456789", http.MethodGet, url, ""); code != http.StatusOK {
+		t.Fatalf("invoker after switch: %v %v", code, body)
+	}
+}
+
+func requestAs(token, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
@@ -57,7 +57,22 @@ func (tis *JsonMethod) GetResponseJsonSchema() *schema.JsonSchema {
 	return result
 }
 
+// MessageToSchema map字段为以值为additionalProperties的object, google.protobuf.*按proto3 json映射不展开,
+// 递归引用的消息不展开字段(Properties为nil)
 func MessageToSchema(msg *desc.MessageDescriptor, root bool) *schema.JsonSchema {
+	return messageToSchema(msg, root, map[string]bool{})
+}
+
+func messageToSchema(msg *desc.MessageDescriptor, root bool, visiting map[string]bool) *schema.JsonSchema {
+	if visiting[msg.GetFullyQualifiedName()] {
+		return &schema.JsonSchema{
+			Title:   msg.GetName(),
+			Type:    schema.JsonSchemaTypeObject,
+			Options: map[string]any{"collapsed": true},
+		}
+	}
+	visiting[msg.GetFullyQualifiedName()] = true
+	defer delete(visiting, msg.GetFullyQualifiedName())
 
 	var result = &schema.JsonSchema{
 		Title:       msg.GetName(),
@@ -121,8 +136,11 @@ func MessageToSchema(msg *desc.MessageDescriptor, root bool) *schema.JsonSchema
 			descriptor.FieldDescriptorProto_TYPE_SINT64:
 			one.Type = schema.JsonSchemaTypeInteger
 		case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
-			one = MessageToSchema(fieldDescriptor.GetMessageType(), false)
-			one.Type = schema.JsonSchemaTypeObject
+			if isWellKnownType(fieldDescriptor.GetMessageType()) {
+				one = wellKnownSchema(fieldDescriptor.GetMessageType())
+				break
+			}
+			one = messageToSchema(fieldDescriptor.GetMessageType(), false, visiting)
 			one.Description = getDescriptor(fieldDescriptor)
 		case descriptor.FieldDescriptorProto_TYPE_ENUM:
 			one.Type = schema.JsonSchemaTypeString
@@ -133,7 +151,16 @@ func MessageToSchema(msg *desc.MessageDescriptor, root bool) *schema.JsonSchema
 
 		}
 
-		if fieldDescriptor.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+		if fieldDescriptor.IsMap() {
+			// protojson中map为object, 键总是字符串
+			one = &schema.JsonSchema{
+				Title:                fieldDescriptor.GetName(),
+				Type:                 schema.JsonSchemaTypeObject,
+				Description:          getDescriptor(fieldDescriptor),
+				AdditionalProperties: one.Properties["value"],
+				Options:              map[string]any{"collapsed": true},
+			}
+		} else if fieldDescriptor.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
 			one = &schema.JsonSchema{
 				Title:       fieldDescriptor.GetName(),
 				Type:        schema.JsonSchemaTypeArray,
@@ -147,3 +174,37 @@ func MessageToSchema(msg *desc.MessageDescriptor, root bool) *schema.JsonSchema
 
 	return result
 }
+
+func isWellKnownType(msg *desc.MessageDescriptor) bool {
+	return strings.HasPrefix(msg.GetFullyQualifiedName(), "google.protobuf.")
+}
+
+// wellKnownSchema google.protobuf.* 的json格式, description保留完整名称, 校验时不检查
+func wellKnownSchema(msg *desc.MessageDescriptor) *schema.JsonSchema {
+	result := &schema.JsonSchema{
+		Title:       msg.GetName(),
+		Type:        schema.JsonSchemaTypeObject,
+		Description: msg.GetFullyQualifiedName(),
+		Options:     map[string]any{"collapsed": true},
+	}
+
+	switch msg.GetFullyQualifiedName() {
+	case "google.protobuf.Timestamp":
+		result.Type = schema.JsonSchemaTypeString
+		result.Format = "date-time"
+	case "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.StringValue", "google.protobuf.BytesValue":
+		result.Type = schema.JsonSchemaTypeString
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		result.Type = schema.JsonSchemaTypeInteger
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue":
+		result.Type = schema.JsonSchemaTypeNumber
+	case "google.protobuf.BoolValue":
+		result.Type = schema.JsonSchemaTypeBoolean
+	case "google.protobuf.ListValue":
+		result.Type = schema.JsonSchemaTypeArray
+	}
+
+	return result
+}
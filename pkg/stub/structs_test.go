@@ -0,0 +1,62 @@
+package stub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/schema"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMessageToSchema(t *testing.T) {
+	timestamp, err := desc.LoadMessageDescriptorForMessage(&timestamppb.Timestamp{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := desc.LoadMessageDescriptorForMessage(&structpb.Struct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := builder.NewMessage("Node")
+	node.AddField(builder.NewField("name", builder.FieldTypeString())).
+		AddField(builder.NewField("created_at", builder.FieldTypeImportedMessage(timestamp))).
+		AddField(builder.NewMapField("labels", builder.FieldTypeString(), builder.FieldTypeInt64())).
+		AddField(builder.NewMapField("children", builder.FieldTypeString(), builder.FieldTypeMessage(node))).
+		AddField(builder.NewField("parent", builder.FieldTypeMessage(node))).
+		AddField(builder.NewField("extra", builder.FieldTypeImportedMessage(object))).
+		AddField(builder.NewField("tags", builder.FieldTypeString()).SetRepeated())
+
+	file, err := builder.NewFile("node.proto").SetPackageName("test").SetProto3(true).AddMessage(node).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := MessageToSchema(file.FindMessage("test.Node"), true)
+
+	// 递归引用的消息不展开, 可以编码
+	if _, err = json.Marshal(s); err != nil {
+		t.Fatal(err)
+	}
+
+	var ok any
+	_ = json.Unmarshal([]byte(`{
+		"name": "root",
+		"createdAt": "2022-01-01T00:00:00Z",
+		"labels": {"a": "1", "b": 2},
+		"children": {"x": {"name": "x", "labels": {"c": 3}, "parent": {"name": "root"}}},
+		"extra": {"k": [1, "v", {"n": null}]},
+		"tags": ["t"]
+	}`), &ok)
+	if errs := schema.Validate(s, ok); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var bad any
+	_ = json.Unmarshal([]byte(`{"name": 1, "labels": {"a": "x"}, "tags": "t"}`), &bad)
+	if errs := schema.Validate(s, bad); len(errs) != 3 {
+		t.Fatal(errs)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/metadata"
 	"log"
+	"sync"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/jhump/protoreflect/desc"
@@ -19,27 +20,49 @@ import (
 )
 
 type Stub struct {
-	host string
-	port int
+	host   string
+	port   int
+	target string
+	opts   []grpc.DialOption
+
+	callOpts []grpc.CallOption
 
 	conn *grpc.ClientConn
-	cli  *grpcreflect.Client
 
 	msgFactory *dynamic.MessageFactory
 
+	// 反射得到的描述, Reflect成功后整体替换
 	serviceSymbols map[string]*ObjectFileDescriptor
 	server         *JsonServer
+	mux            sync.RWMutex
 }
 
-func NewStub(host string, port int) *Stub {
+// NewStub opts在Connect时使用, 如keepalive, authority等
+func NewStub(host string, port int, opts ...grpc.DialOption) *Stub {
 	return &Stub{
 		host:           host,
 		port:           port,
+		opts:           opts,
+		serviceSymbols: map[string]*ObjectFileDescriptor{},
+		server:         &JsonServer{},
+	}
+}
+
+// NewTargetStub 使用完整的gRPC target, 如 unix:///tmp/grpc.sock, dns:///svc:50051
+func NewTargetStub(target string, opts ...grpc.DialOption) *Stub {
+	return &Stub{
+		target:         target,
+		opts:           opts,
 		serviceSymbols: map[string]*ObjectFileDescriptor{},
 		server:         &JsonServer{},
 	}
 }
 
+// SetCallOptions 调用方法时使用, 如消息大小和压缩, 不影响反射
+func (tis *Stub) SetCallOptions(opts ...grpc.CallOption) {
+	tis.callOpts = opts
+}
+
 func (tis *Stub) GetState() connectivity.State {
 	if tis.conn == nil {
 		return connectivity.Shutdown
@@ -55,56 +78,85 @@ func (tis *Stub) Port() int {
 	return tis.port
 }
 
+// Target 连接的地址, 未指定target时为 host:port
+func (tis *Stub) Target() string {
+	if len(tis.target) > 0 {
+		return tis.target
+	}
+
+	return fmt.Sprintf("%v:%v", tis.host, tis.port)
+}
+
+// Connect 创建连接并反射服务描述
 func (tis *Stub) Connect(ctx context.Context) error {
-	target := fmt.Sprintf("%v:%v", tis.host, tis.port)
+	if err := tis.Dial(); err != nil {
+		return err
+	}
+
+	return tis.Reflect(ctx)
+}
 
-	conn, err := grpc.DialContext(ctx, target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// Dial 创建连接, 不等待连接成功
+func (tis *Stub) Dial() error {
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, tis.opts...)
+	conn, err := grpc.Dial(tis.Target(), opts...)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	conn.GetState()
 	tis.conn = conn
-	tis.cli = grpcreflect.NewClientV1Alpha(context.TODO(), grpc_reflection_v1alpha.NewServerReflectionClient(tis.conn))
 
-	if err = tis.loadServiceInfo(); err != nil {
+	var ext dynamic.ExtensionRegistry
+	tis.msgFactory = dynamic.NewMessageFactoryWithExtensionRegistry(&ext)
+
+	return nil
+}
+
+// Reflect 通过反射重新加载服务描述, 失败时保留原来的描述
+func (tis *Stub) Reflect(ctx context.Context) error {
+	cli := grpcreflect.NewClientV1Alpha(ctx, grpc_reflection_v1alpha.NewServerReflectionClient(tis.conn))
+	defer cli.Reset()
+
+	serviceSymbols, err := loadServiceInfo(cli)
+	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	{
-		for _, descriptor := range tis.serviceSymbols {
-			for _, serviceDescriptor := range descriptor.GetFileDescriptor().GetServices() {
-				objectService := &JsonService{
-					Name:    serviceDescriptor.GetFullyQualifiedName(),
-					Methods: []*JsonMethod{},
-				}
+	server := &JsonServer{}
+	for _, descriptor := range serviceSymbols {
+		for _, serviceDescriptor := range descriptor.GetFileDescriptor().GetServices() {
+			objectService := &JsonService{
+				Name:    serviceDescriptor.GetFullyQualifiedName(),
+				Methods: []*JsonMethod{},
+			}
 
-				for _, methodDescriptor := range serviceDescriptor.GetMethods() {
-					if methodDescriptor.IsServerStreaming() || methodDescriptor.IsClientStreaming() {
-						log.Printf("[stream] %v, server stream: %v, client stream: %v",
-							methodDescriptor.GetFullyQualifiedName(), methodDescriptor.IsServerStreaming(), methodDescriptor.IsClientStreaming())
-						continue
-					}
-
-					objectMethod := &JsonMethod{
-						Name:     methodDescriptor.GetName(),
-						Request:  methodDescriptor.GetInputType().GetName(),
-						Response: methodDescriptor.GetOutputType().GetName(),
-						mtd:      methodDescriptor,
-					}
-					objectService.Methods = append(objectService.Methods, objectMethod)
+			for _, methodDescriptor := range serviceDescriptor.GetMethods() {
+				if methodDescriptor.IsServerStreaming() || methodDescriptor.IsClientStreaming() {
+					log.Printf("[stream] %v, server stream: %v, client stream: %v",
+						methodDescriptor.GetFullyQualifiedName(), methodDescriptor.IsServerStreaming(), methodDescriptor.IsClientStreaming())
+					continue
 				}
 
-				tis.server.Services = append(tis.server.Services, objectService)
+				objectMethod := &JsonMethod{
+					Name:     methodDescriptor.GetName(),
+					Request:  methodDescriptor.GetInputType().GetName(),
+					Response: methodDescriptor.GetOutputType().GetName(),
+					mtd:      methodDescriptor,
+				}
+				objectService.Methods = append(objectService.Methods, objectMethod)
 			}
+
+			server.Services = append(server.Services, objectService)
 		}
 	}
 
-	var ext dynamic.ExtensionRegistry
-	tis.msgFactory = dynamic.NewMessageFactoryWithExtensionRegistry(&ext)
+	tis.mux.Lock()
+	defer tis.mux.Unlock()
 
+	tis.serviceSymbols = serviceSymbols
+	tis.server = server
 	return nil
 }
 
@@ -114,7 +166,7 @@ func (tis *Stub) Connect(ctx context.Context) error {
 func (tis *Stub) InvokeRPC(ctx context.Context, service, method string, requestJsonData string, head map[string]string) (res string, header, trailer metadata.MD, err error) {
 
 	// 查找方法
-	objectMethod, ok := tis.server.GetMethod(service, method)
+	objectMethod, ok := tis.GetServerInfo().GetMethod(service, method)
 	if !ok {
 		return "", nil, nil, fmt.Errorf("not found [%v:%v]", service, method)
 	}
@@ -133,7 +185,8 @@ func (tis *Stub) InvokeRPC(ctx context.Context, service, method string, requestJ
 	stub := grpcdynamic.NewStubWithMessageFactory(tis.conn, tis.msgFactory)
 
 	// 执行调用
-	resp, err := stub.InvokeRpc(ctx, mtd, req, grpc.Header(&header), grpc.Trailer(&trailer))
+	opts := append([]grpc.CallOption{grpc.Header(&header), grpc.Trailer(&trailer)}, tis.callOpts...)
+	resp, err := stub.InvokeRpc(ctx, mtd, req, opts...)
 	if err != nil {
 		// 错误
 		return "", nil, nil, err
@@ -154,21 +207,69 @@ func (tis *Stub) InvokeRPC(ctx context.Context, service, method string, requestJ
 }
 
 func (tis *Stub) GetObjectFileSymbol() map[string]*ObjectFileDescriptor {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
 	return tis.serviceSymbols
 }
 
+// Close 关闭连接
+func (tis *Stub) Close() {
+	if tis.conn != nil {
+		_ = tis.conn.Close()
+	}
+}
+
+// GetConn grpc连接
+func (tis *Stub) GetConn() *grpc.ClientConn {
+	return tis.conn
+}
+
+// FindMethodDescriptor 查找方法描述, 包括stream方法
+func (tis *Stub) FindMethodDescriptor(service, method string) (*desc.MethodDescriptor, bool) {
+	for _, fd := range tis.GetFileDescriptors() {
+		if sd := fd.FindService(service); sd != nil {
+			if mtd := sd.FindMethodByName(method); mtd != nil {
+				return mtd, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// GetFileDescriptors 反射得到的全部文件描述(去重)
+func (tis *Stub) GetFileDescriptors() []*desc.FileDescriptor {
+	var result []*desc.FileDescriptor
+	seen := map[string]bool{}
+	for _, symbol := range tis.GetObjectFileSymbol() {
+		fd := symbol.GetFileDescriptor()
+		if fd == nil || seen[fd.GetName()] {
+			continue
+		}
+
+		seen[fd.GetName()] = true
+		result = append(result, fd)
+	}
+
+	return result
+}
+
 func (tis *Stub) GetServerInfo() *JsonServer {
+	tis.mux.RLock()
+	defer tis.mux.RUnlock()
+
 	return tis.server
 }
 
-func (tis *Stub) loadServiceInfo() error {
-	cli := tis.cli
+func loadServiceInfo(cli *grpcreflect.Client) (map[string]*ObjectFileDescriptor, error) {
 	serviceSymbols, err := cli.ListServices()
 	if err != nil {
-		log.Println(err)
-		return err
+		return nil, err
 	}
 
+	result := map[string]*ObjectFileDescriptor{}
+
 	for _, symbolName := range serviceSymbols {
 		if symbolName == "grpc.reflection.v1alpha.ServerReflection" {
 			continue
@@ -176,17 +277,16 @@ func (tis *Stub) loadServiceInfo() error {
 
 		fileDesc, err := cli.FileContainingSymbol(symbolName)
 		if err != nil {
-			log.Println(err)
-			return err
+			return nil, err
 		}
 
-		tis.serviceSymbols[symbolName] = &ObjectFileDescriptor{
+		result[symbolName] = &ObjectFileDescriptor{
 			symbolName: symbolName,
 			fileDesc:   fileDesc,
 		}
 	}
 
-	return nil
+	return result, nil
 }
 
 type ObjectFileDescriptor struct {
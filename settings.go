@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+)
+
+// 环境变量, 优先级: 命令行 > 环境变量 > 配置文件 > 默认值
+const (
+	EnvListen      = "GRPC_INVOKE_LISTEN"       // :8888, [::]:8888, unix:///tmp/grpc_invoke.sock
+	EnvOpenBrowser = "GRPC_INVOKE_OPEN_BROWSER" // true, false
+	EnvLogLevel    = "GRPC_INVOKE_LOG_LEVEL"    // debug, info, error, silent
+	EnvTraefik     = "GRPC_INVOKE_TRAEFIK"      // traefik api地址, 为空时不启用
+	EnvServices    = "GRPC_INVOKE_SERVICES"     // name=host:port,host:port,name=dns:///svc:50051
+)
+
+type settings struct {
+	Listen      string
+	OpenBrowser bool
+	LogLevel    string
+	Traefik     string
+	Services    []config.Service
+}
+
+type settingFlags struct {
+	listen      *string
+	port        *int
+	openBrowser *bool
+	logLevel    *string
+	traefik     *string
+	services    stringFlags
+}
+
+func newSettingFlags() *settingFlags {
+	tis := &settingFlags{
+		listen:      flag.String("listen", "", "listen address, :8888, [::1]:8888 or unix:///path.sock, env "+EnvListen),
+		port:        flag.Int("port", 8888, "listen port, ignored when -listen is set"),
+		openBrowser: flag.Bool("open-browser", true, "open the web ui in a browser, env "+EnvOpenBrowser),
+		logLevel:    flag.String("log-level", "info", "debug, info, error or silent, env "+EnvLogLevel),
+		traefik:     flag.String("traefik", config.DefaultTraefik, "traefik api address for service discovery, empty to disable, env "+EnvTraefik),
+	}
+	flag.Var(&tis.services, "service", "gRPC service name=host:port or name=target (unix:///path.sock, dns:///svc:50051), repeatable, env "+EnvServices+" comma separated")
+
+	return tis
+}
+
+// resolve 需在flag.Parse之后调用
+func (tis *settingFlags) resolve() (*settings, error) {
+	cfg := config.GetConfig()
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// 依次取 命令行, 环境变量, 配置文件, 默认值
+	var pick = func(name string, flagValue string, env string, file string, fileSet bool) string {
+		if set[name] {
+			return flagValue
+		}
+		if value, ok := os.LookupEnv(env); ok {
+			return value
+		}
+		if fileSet {
+			return file
+		}
+		return flagValue
+	}
+
+	result := &settings{}
+
+	result.Listen = pick("listen", *tis.listen, EnvListen, cfg.Listen, len(cfg.Listen) > 0)
+	if len(result.Listen) == 0 || (set["port"] && !set["listen"]) {
+		result.Listen = fmt.Sprintf(":%v", *tis.port)
+	}
+
+	var fileOpenBrowser string
+	if cfg.OpenBrowser != nil {
+		fileOpenBrowser = strconv.FormatBool(*cfg.OpenBrowser)
+	}
+	openBrowser := pick("open-browser", strconv.FormatBool(*tis.openBrowser), EnvOpenBrowser, fileOpenBrowser, cfg.OpenBrowser != nil)
+	var err error
+	if result.OpenBrowser, err = strconv.ParseBool(openBrowser); err != nil {
+		return nil, fmt.Errorf("%v: %v", EnvOpenBrowser, err)
+	}
+
+	result.LogLevel = pick("log-level", *tis.logLevel, EnvLogLevel, cfg.LogLevel, len(cfg.LogLevel) > 0)
+
+	var fileTraefik string
+	if cfg.Discovery != nil {
+		fileTraefik = cfg.Discovery.Traefik
+	}
+	result.Traefik = pick("traefik", *tis.traefik, EnvTraefik, fileTraefik, cfg.Discovery != nil)
+
+	// 命令行和环境变量的服务添加到配置文件的服务之外
+	services := []string(tis.services)
+	if !set["service"] {
+		for _, item := range strings.Split(os.Getenv(EnvServices), ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				services = append(services, item)
+			}
+		}
+	}
+	for _, item := range services {
+		service, err := parseService(item)
+		if err != nil {
+			return nil, err
+		}
+		result.Services = append(result.Services, service)
+	}
+
+	return result, nil
+}
+
+// parseService name=address 或 address, address为host:port或完整的gRPC target, 如 unix:///tmp/grpc.sock, dns:///svc:50051
+func parseService(value string) (config.Service, error) {
+	name, address, ok := strings.Cut(value, "=")
+	if !ok || strings.Contains(name, ":") {
+		// 没有名称, =属于target
+		address = value
+		name = value
+	}
+
+	if strings.Contains(address, "://") || strings.HasPrefix(address, "unix:") {
+		service := config.Service{Name: name, Target: address}
+		if err := service.Validate(); err != nil {
+			return config.Service{}, fmt.Errorf("service %q: %v", value, err)
+		}
+		return service, nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return config.Service{}, fmt.Errorf("service %q: %v", value, err)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return config.Service{}, fmt.Errorf("service %q: invalid port %v", value, port)
+	}
+
+	return config.Service{Name: name, Host: host, Port: n}, nil
+}
+
+// browserURL 监听全部地址时使用127.0.0.1, unix socket返回空
+func browserURL(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+
+	host := "127.0.0.1"
+	if !tcp.IP.IsUnspecified() {
+		host = tcp.IP.String()
+	}
+
+	return fmt.Sprintf("http://%v", net.JoinHostPort(host, strconv.Itoa(tcp.Port)))
+}
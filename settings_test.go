@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/general252/grpc_invoke/pkg/config"
+)
+
+// TestResolvePrecedence 命令行 > 环境变量 > 配置文件 > 默认值
+func TestResolvePrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    string
+		file   string
+		listen string
+		level  string
+	}{
+		{name: "default", listen: ":8888", level: "info"},
+		{name: "file", file: `{"listen": ":7001", "log_level": "error"}`, listen: ":7001", level: "error"},
+		{name: "env over file", env: "debug", file: `{"listen": ":7001", "log_level": "error"}`, listen: ":7001", level: "debug"},
+		{name: "flag over env", args: []string{"-log-level", "silent", "-port", "7002"}, env: "debug", file: `{"listen": ":7001", "log_level": "error"}`, listen: ":7002", level: "silent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if len(tt.file) > 0 {
+				if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := config.SetWorkspaceRoot(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Setenv(EnvListen, "")
+			_ = os.Unsetenv(EnvListen)
+			t.Setenv(EnvLogLevel, tt.env)
+			if len(tt.env) == 0 {
+				_ = os.Unsetenv(EnvLogLevel)
+			}
+
+			flag.CommandLine = flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			flags := newSettingFlags()
+			if err := flag.CommandLine.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := flags.resolve()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Listen != tt.listen || result.LogLevel != tt.level {
+				t.Errorf("listen %v, log level %v", result.Listen, result.LogLevel)
+			}
+		})
+	}
+}
+
+func TestParseService(t *testing.T) {
+	tests := []struct {
+		value string
+		want  config.Service
+	}{
+		{value: "127.0.0.1:50051", want: config.Service{Name: "127.0.0.1:50051", Host: "127.0.0.1", Port: 50051}},
+		{value: "hello=[::1]:50051", want: config.Service{Name: "hello", Host: "::1", Port: 50051}},
+		{value: "unix:///tmp/grpc.sock", want: config.Service{Name: "unix:///tmp/grpc.sock", Target: "unix:///tmp/grpc.sock"}},
+		{value: "hello=dns:///svc:50051", want: config.Service{Name: "hello", Target: "dns:///svc:50051"}},
+		{value: "passthrough:///127.0.0.1:50051", want: config.Service{Name: "passthrough:///127.0.0.1:50051", Target: "passthrough:///127.0.0.1:50051"}},
+	}
+	for _, tt := range tests {
+		got, err := parseService(tt.value)
+		if err != nil {
+			t.Errorf("%v: %v", tt.value, err)
+		} else if got.Name != tt.want.Name || got.Host != tt.want.Host || got.Port != tt.want.Port || got.Target != tt.want.Target {
+			t.Errorf("%v: %+v", tt.value, got)
+		}
+	}
+
+	for _, value := range []string{"hello", "hello=127.0.0.1", "127.0.0.1:0"} {
+		if _, err := parseService(value); err == nil {
+			t.Errorf("%v: want error", value)
+		}
+	}
+}